@@ -0,0 +1,168 @@
+// Command admin runs maintenance tasks against the weight tracker database.
+// It reads DB_PATH like the server does and must be run from the directory
+// holding the migrations.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"weight-tracker/internal/config"
+	"weight-tracker/internal/models"
+)
+
+const usage = `Usage: admin [-db path] <command> [arguments]
+
+Commands:
+  reset-password <username>   Issue a one-time code the user can redeem at /reset-password
+  disable-2fa <username>      Turn off two-factor authentication for a user who lost their device
+  lockouts [count]            List the most recent login lockouts (default 20)
+  unlock <username|ip>        Clear failed logins and any lockout for a username or IP
+`
+
+func main() {
+	cfg := config.Load()
+
+	flags := flag.NewFlagSet("admin", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	dbPath := flags.String("db", cfg.DatabasePath, "path to the SQLite database")
+	flags.Parse(os.Args[1:])
+
+	args := flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	database, err := config.NewDatabase(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "reset-password":
+		if len(args) != 2 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		err = resetPassword(database.GetDB(), args[1])
+	case "disable-2fa":
+		if len(args) != 2 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		err = disableTwoFactor(database.GetDB(), args[1])
+	case "lockouts":
+		count := 20
+		if len(args) == 2 {
+			if count, err = strconv.Atoi(args[1]); err != nil || count < 1 {
+				flags.Usage()
+				os.Exit(2)
+			}
+		}
+		err = listLockouts(database.GetDB(), cfg, count)
+	case "unlock":
+		if len(args) != 2 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		err = unlock(database.GetDB(), cfg, args[1])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// resetPassword issues a reset code for the user and prints it. Any earlier
+// code for the user stops working.
+func resetPassword(db *sql.DB, username string) error {
+	user, err := models.NewUserRepository(db).GetByUsername(username)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no user named %q", username)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	code, expiresAt, err := models.NewPasswordResetRepository(db).Create(user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Reset code for %s: %s\n", user.Username, code)
+	fmt.Printf("It works once and expires at %s.\n", expiresAt.Local().Format(time.RFC1123))
+	return nil
+}
+
+// disableTwoFactor turns off two-factor authentication for a user who has
+// lost both their authenticator app and their recovery codes.
+func disableTwoFactor(db *sql.DB, username string) error {
+	user, err := models.NewUserRepository(db).GetByUsername(username)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no user named %q", username)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	repo := models.NewTwoFactorRepository(db)
+	enabled, err := repo.IsEnabled(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check two-factor status: %w", err)
+	}
+	if !enabled {
+		fmt.Printf("Two-factor authentication is not enabled for %s.\n", user.Username)
+		return nil
+	}
+
+	if err := repo.Disable(user.ID); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	fmt.Printf("Disabled two-factor authentication for %s.\n", user.Username)
+	return nil
+}
+
+func listLockouts(db *sql.DB, cfg *config.Config, count int) error {
+	lockouts, err := models.NewLoginThrottleRepository(db, cfg.LoginPolicy()).ListLockouts(count)
+	if err != nil {
+		return fmt.Errorf("failed to list lockouts: %w", err)
+	}
+	if len(lockouts) == 0 {
+		fmt.Println("No lockouts recorded.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LOCKED AT\tUNTIL\tKIND\tVALUE\tFAILURES\tFROM IP")
+	for _, l := range lockouts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n",
+			l.LockedAt.Local().Format(time.DateTime), l.LockedUntil.Local().Format(time.DateTime),
+			l.Kind, l.Value, l.Failures, l.IPAddress)
+	}
+	return w.Flush()
+}
+
+func unlock(db *sql.DB, cfg *config.Config, value string) error {
+	n, err := models.NewLoginThrottleRepository(db, cfg.LoginPolicy()).Unlock(value)
+	if err != nil {
+		return fmt.Errorf("failed to unlock: %w", err)
+	}
+	if n == 0 {
+		fmt.Printf("No failed logins recorded for %s.\n", value)
+		return nil
+	}
+	fmt.Printf("Cleared failed logins for %s.\n", value)
+	return nil
+}
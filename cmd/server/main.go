@@ -7,12 +7,15 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Timezone database for users' zones on minimal images
 	"weight-tracker/internal/config"
 	"weight-tracker/internal/handlers"
 	"weight-tracker/internal/middleware"
 	"weight-tracker/internal/models"
+	"weight-tracker/static"
 )
 
 type application struct {
@@ -37,20 +40,29 @@ func main() {
 	}
 
 	// Initialize handlers
-	pageHandler := handlers.NewPageHandler()
-	authHandler := handlers.NewAuthHandler(app.db)
+	pageHandler := handlers.NewPageHandler(app.db)
+	authHandler := handlers.NewAuthHandler(app.db, cfg.LoginPolicy(), cfg.Cookies())
 	weightHandler := handlers.NewWeightHandler(app.db)
 	chartHandler := handlers.NewChartHandler(app.db)
 	healthHandler := handlers.NewHealthHandler(app.db)
+	accountHandler := handlers.NewAccountHandler(app.db, cfg.LoginPolicy(), cfg.Cookies())
+	weightAPIHandler := handlers.NewWeightAPIHandler(app.db)
+	goalHandler := handlers.NewGoalHandler(app.db)
+	exportHandler := handlers.NewExportHandler(app.db)
+	importHandler := handlers.NewImportHandler(app.db)
 
 	// Setup middleware
-	authMiddleware := middleware.AuthMiddleware(models.NewUserRepository(app.db))
+	userRepo := models.NewUserRepository(app.db)
+	sessionRepo := models.NewSessionRepository(app.db)
+	loginThrottleRepo := models.NewLoginThrottleRepository(app.db, cfg.LoginPolicy())
+	twoFactorRepo := models.NewTwoFactorRepository(app.db)
+	authMiddleware := middleware.AuthMiddleware(userRepo, sessionRepo, models.NewAPITokenRepository(app.db), cfg.Cookies())
 
 	// Setup routes
 	mux := http.NewServeMux()
 
 	// Static files
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static/"))))
+	mux.Handle("/static/", http.StripPrefix("/static/", static.Handler()))
 
 	// Public routes
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -62,28 +74,66 @@ func main() {
 	})
 
 	mux.HandleFunc("/login", authHandler.ShowLogin)
+	mux.HandleFunc("/login/verify", authHandler.VerifyLogin)
 	mux.HandleFunc("/register", authHandler.ShowRegister)
 	mux.HandleFunc("/logout", authHandler.Logout)
-mux.HandleFunc("/health", healthHandler.Health)
+	mux.HandleFunc("/reset-password", authHandler.ResetPassword)
+	mux.HandleFunc("/health", healthHandler.Health)
 
 	// Protected routes
 	protectedMux := http.NewServeMux()
-	protectedMux.HandleFunc("/weights", weightHandler.ShowWeights)
-	protectedMux.HandleFunc("/weights/", weightHandler.CreateWeight)
+	protectedMux.HandleFunc("GET /weights", weightHandler.ShowWeights)
+	protectedMux.HandleFunc("POST /weights", weightHandler.CreateWeight)
+	protectedMux.HandleFunc("POST /weights/", weightHandler.CreateWeight)
+	protectedMux.HandleFunc("DELETE /weights", weightHandler.DeleteWeight)
+	protectedMux.HandleFunc("GET /weights/{id}", weightHandler.ShowWeightRow)
+	protectedMux.HandleFunc("GET /weights/{id}/edit", weightHandler.EditWeight)
+	protectedMux.HandleFunc("PUT /weights/{id}", weightHandler.UpdateWeight)
+	protectedMux.HandleFunc("/goals", goalHandler.Goals)
+	protectedMux.HandleFunc("/goals/close", goalHandler.CloseGoal)
+	protectedMux.HandleFunc("/export/weights.csv", exportHandler.WeightsCSV)
+	protectedMux.HandleFunc("/import", importHandler.Import)
 	protectedMux.HandleFunc("/api/chart/weight-data", chartHandler.GetWeightChartData)
 	protectedMux.HandleFunc("/api/chart/weight-stats", chartHandler.GetWeightStats)
-
-	// Apply auth middleware to all routes to set context values
-	// This ensures that all requests have proper context values set
-	allRoutesMux := authMiddleware(mux)
+	protectedMux.HandleFunc("/account/sessions", accountHandler.Sessions)
+	protectedMux.HandleFunc("/account/sessions/revoke-others", accountHandler.RevokeOtherSessions)
+	protectedMux.HandleFunc("/account/tokens", accountHandler.Tokens)
+	protectedMux.HandleFunc("/account/settings", accountHandler.Settings)
+	protectedMux.HandleFunc("/account/data", accountHandler.Data)
+	protectedMux.HandleFunc("GET /account/data/export", accountHandler.DataExport)
+	protectedMux.HandleFunc("/account/delete", accountHandler.DeleteAccount)
+	protectedMux.HandleFunc("/account/password", accountHandler.ChangePassword)
+	protectedMux.HandleFunc("/account/two-factor", accountHandler.TwoFactor)
+	protectedMux.HandleFunc("/api/account/sessions", accountHandler.SessionsAPI)
+	protectedMux.HandleFunc("/api/account/sessions/revoke-others", accountHandler.RevokeOtherSessionsAPI)
+
+	// Versioned JSON API
+	protectedMux.HandleFunc("/api/v1/weights", weightAPIHandler.Weights)
+	protectedMux.HandleFunc("/api/v1/weights/{id}", weightAPIHandler.Weight)
+	protectedMux.HandleFunc("/api/v1/export/weights.csv", exportHandler.WeightsCSVAPI)
+	protectedMux.HandleFunc("GET /api/v1/account/export", accountHandler.ExportAPI)
+	protectedMux.HandleFunc("POST /api/v1/account/import", accountHandler.ImportAPI)
+	protectedMux.HandleFunc("DELETE /api/v1/account", accountHandler.DeleteAccountAPI)
 
 	// Create a handler that routes between protected and public routes
 	finalHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Versioned API - require authentication, answer with JSON errors
+		if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+			middleware.RequireAPIAuth(protectedMux).ServeHTTP(w, r)
+			return
+		}
+
 		// Protected routes - require authentication
 		if r.URL.Path == "/weights" ||
-			(r.URL.Path == "/weights/" && r.Method == http.MethodPost) ||
+			strings.HasPrefix(r.URL.Path, "/weights/") ||
+			r.URL.Path == "/goals" ||
+			strings.HasPrefix(r.URL.Path, "/goals/") ||
+			strings.HasPrefix(r.URL.Path, "/export/") ||
+			r.URL.Path == "/import" ||
 			r.URL.Path == "/api/chart/weight-data" ||
-			r.URL.Path == "/api/chart/weight-stats" {
+			r.URL.Path == "/api/chart/weight-stats" ||
+			strings.HasPrefix(r.URL.Path, "/account/") ||
+			strings.HasPrefix(r.URL.Path, "/api/account/") {
 
 			// Use RequireAuth middleware to protect these routes
 			// RequireAuth checks the context values already set by authMiddleware
@@ -92,13 +142,21 @@ mux.HandleFunc("/health", healthHandler.Health)
 			return
 		}
 
-		// Public routes - serve through the auth middleware (which sets context but doesn't require login)
-		allRoutesMux.ServeHTTP(w, r)
+		// Public routes - context is set but login isn't required
+		mux.ServeHTTP(w, r)
 	})
 
-	// Apply global middleware
-	var handler http.Handler = finalHandler
-	handler = middleware.Logging(middleware.SecurityHeaders(handler))
+	// Apply auth middleware to all routes to set context values
+	// This ensures that all requests have proper context values set
+	var handler http.Handler = authMiddleware(finalHandler)
+
+	// Apply global middleware. CSRF checks run before authentication so a
+	// forged request never touches the session, and proxy headers are read
+	// first so everything after sees the real client.
+	handler = middleware.CSRF(cfg.Cookies())(handler)
+	handler = middleware.SecurityHeaders(handler)
+	handler = middleware.TrustProxies(cfg.TrustedProxies)(handler)
+	handler = middleware.Logging(handler)
 
 	// Create server
 	srv := &http.Server{
@@ -113,9 +171,52 @@ mux.HandleFunc("/health", healthHandler.Health)
 	log.Printf("Starting server on port %s", cfg.Port)
 	log.Printf("Database: %s", cfg.DatabasePath)
 	log.Printf("Environment: %s", cfg.Env)
+	if cfg.TLSEnabled() {
+		log.Printf("Serving HTTPS with %s", cfg.TLSCertFile)
+	}
+	if cfg.SecureCookies && !cfg.TLSEnabled() && len(cfg.TrustedProxies) == 0 {
+		log.Printf("Cookies are HTTPS-only but there is no TLS or trusted proxy; serve the app over HTTPS or set COOKIE_SECURE=false")
+	}
+	if missing := static.Missing(); len(missing) > 0 {
+		log.Printf("Missing vendored assets %s; run `make assets` before building", strings.Join(missing, ", "))
+	}
 
+	// Periodically purge expired sessions, stale login failure counts,
+	// abandoned two-factor logins and accounts whose grace period ended
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := sessionRepo.DeleteExpired(); err != nil {
+				log.Printf("Failed to purge expired sessions: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d expired sessions", n)
+			}
+
+			if _, err := loginThrottleRepo.Purge(time.Now()); err != nil {
+				log.Printf("Failed to purge login throttles: %v", err)
+			}
+
+			if _, err := twoFactorRepo.PurgeLoginChallenges(time.Now()); err != nil {
+				log.Printf("Failed to purge login challenges: %v", err)
+			}
+
+			if n, err := userRepo.PurgeScheduled(time.Now()); err != nil {
+				log.Printf("Failed to purge deleted accounts: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d deleted accounts", n)
+			}
+		}
+	}()
+
+	go func() {
+		var err error
+		if cfg.TLSEnabled() {
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
 		}
 	}()
@@ -136,4 +237,4 @@ mux.HandleFunc("/health", healthHandler.Health)
 	}
 
 	log.Println("Server shutdown complete")
-}
\ No newline at end of file
+}
@@ -1,20 +1,88 @@
 package config
 
 import (
+	"log"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
 )
 
 type Config struct {
-	Port       string
+	Port         string
 	DatabasePath string
-	Env       string
+	Env          string // "production" turns on secure cookies
+
+	// TLS is served directly when both files are set; otherwise put a
+	// reverse proxy that terminates TLS in front of the server.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TrustedProxies are the addresses whose X-Forwarded-For and
+	// X-Forwarded-Proto headers are believed.
+	TrustedProxies []netip.Prefix
+	// SecureCookies sends cookies over HTTPS only, with the __Host- prefix.
+	SecureCookies bool
+
+	// Brute-force protection for the login form
+	LoginMaxFailures      int           // Failed logins for one username before it is locked
+	LoginMaxFailuresPerIP int           // Failed logins from one IP before it is locked
+	LoginFailureWindow    time.Duration // Failures older than this are forgotten
+	LoginBackoff          time.Duration // Wait after the first failure, doubling with each further one
+	LoginLockout          time.Duration // How long a lockout lasts
 }
 
 func Load() *Config {
+	env := getEnv("ENV", "development")
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		log.Printf("Ignoring TLS_CERT_FILE and TLS_KEY_FILE: both must be set")
+		certFile, keyFile = "", ""
+	}
+
 	return &Config{
-		Port:        getEnv("PORT", "8080"),
+		Port:         getEnv("PORT", "8080"),
 		DatabasePath: getEnv("DB_PATH", "./data/weights.db"),
-		Env:        getEnv("ENV", "development"),
+		Env:          env,
+
+		TLSCertFile:    certFile,
+		TLSKeyFile:     keyFile,
+		TrustedProxies: getEnvPrefixes("TRUSTED_PROXIES"),
+		SecureCookies:  getEnvBool("COOKIE_SECURE", env == "production" || certFile != ""),
+
+		LoginMaxFailures:      getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxFailuresPerIP: getEnvInt("LOGIN_MAX_FAILURES_PER_IP", 20),
+		LoginFailureWindow:    getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginBackoff:          getEnvDuration("LOGIN_BACKOFF", time.Second),
+		LoginLockout:          getEnvDuration("LOGIN_LOCKOUT", 15*time.Minute),
+	}
+}
+
+// IsProduction reports whether ENV is "production".
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// TLSEnabled reports whether the server terminates TLS itself.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// Cookies returns how the app's cookies are flagged.
+func (c *Config) Cookies() middleware.Cookies {
+	return middleware.Cookies{Secure: c.SecureCookies}
+}
+
+// LoginPolicy returns the login throttling settings.
+func (c *Config) LoginPolicy() models.LoginPolicy {
+	return models.LoginPolicy{
+		MaxFailures:      c.LoginMaxFailures,
+		MaxFailuresPerIP: c.LoginMaxFailuresPerIP,
+		Window:           c.LoginFailureWindow,
+		Backoff:          c.LoginBackoff,
+		Lockout:          c.LoginLockout,
 	}
 }
 
@@ -23,4 +91,76 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// getEnvInt reads a positive integer, falling back to defaultValue if the
+// variable is unset or invalid.
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("Ignoring invalid %s=%q, using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvDuration reads a positive duration such as "15m", falling back to
+// defaultValue if the variable is unset or invalid.
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getEnvBool reads "true" or "false" (or 1/0), falling back to defaultValue
+// if the variable is unset or invalid.
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Ignoring invalid %s=%q, using %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return b
+}
+
+// getEnvPrefixes reads a comma-separated list of IP addresses and CIDR
+// ranges such as "127.0.0.1, 10.0.0.0/8". Invalid entries are skipped.
+func getEnvPrefixes(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			log.Printf("Ignoring invalid address %q in %s", value, key)
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
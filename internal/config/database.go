@@ -22,7 +22,13 @@ func NewDatabase(dbPath string) (*Database, error) {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// Write times in SQLite's own format so date functions and range
+	// comparisons in SQL understand the stored values. Foreign keys are off
+	// by default in SQLite and must be enabled on every connection for the
+	// schema's ON DELETE CASCADE to apply. Transactions take the write lock
+	// when they begin, so ones that read before writing, like the login
+	// throttle, run one at a time instead of failing with SQLITE_BUSY.
+	db, err := sql.Open("sqlite", dbPath+"?_time_format=sqlite&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -120,4 +126,4 @@ func (d *Database) Close() error {
 
 func (d *Database) GetDB() *sql.DB {
 	return d.db
-}
\ No newline at end of file
+}
@@ -0,0 +1,888 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
+	"weight-tracker/internal/totp"
+)
+
+type AccountHandler struct {
+	userRepo      *models.UserRepository
+	sessionRepo   *models.SessionRepository
+	apiTokenRepo  *models.APITokenRepository
+	settingsRepo  *models.SettingsRepository
+	archiveRepo   *models.ArchiveRepository
+	twoFactorRepo *models.TwoFactorRepository
+	throttle      *models.LoginThrottleRepository
+	cookies       middleware.Cookies
+	sessionsTmpl  *template.Template
+	tokensTmpl    *template.Template
+	settingsTmpl  *template.Template
+	dataTmpl      *template.Template
+	deleteTmpl    *template.Template
+	passwordTmpl  *template.Template
+	twoFactorTmpl *template.Template
+}
+
+func NewAccountHandler(db *sql.DB, loginPolicy models.LoginPolicy, cookies middleware.Cookies) *AccountHandler {
+	return &AccountHandler{
+		userRepo:      models.NewUserRepository(db),
+		sessionRepo:   models.NewSessionRepository(db),
+		apiTokenRepo:  models.NewAPITokenRepository(db),
+		settingsRepo:  models.NewSettingsRepository(db),
+		archiveRepo:   models.NewArchiveRepository(db),
+		twoFactorRepo: models.NewTwoFactorRepository(db),
+		throttle:      models.NewLoginThrottleRepository(db, loginPolicy),
+		cookies:       cookies,
+		sessionsTmpl:  newPageTemplate("templates/account_sessions.html"),
+		tokensTmpl:    newPageTemplate("templates/account_tokens.html"),
+		settingsTmpl:  newPageTemplate("templates/account_settings.html"),
+		dataTmpl:      newPageTemplate("templates/account_data.html"),
+		deleteTmpl:    newPageTemplate("templates/account_delete.html"),
+		passwordTmpl:  newPageTemplate("templates/account_password.html"),
+		twoFactorTmpl: newPageTemplate("templates/account_two_factor.html"),
+	}
+}
+
+// sessionView is a session as shown to its owner, flagged when it belongs to
+// the browser making the request.
+type sessionView struct {
+	ID         int       `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func (h *AccountHandler) listSessions(r *http.Request) ([]sessionView, error) {
+	sessions, err := h.sessionRepo.ListByUser(middleware.GetUserID(r))
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := h.userLocation(r)
+	if err != nil {
+		return nil, err
+	}
+
+	currentID := 0
+	if current := middleware.GetSession(r); current != nil {
+		currentID = current.ID
+	}
+
+	views := make([]sessionView, 0, len(sessions))
+	for _, s := range sessions {
+		views = append(views, sessionView{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IPAddress,
+			CreatedAt:  s.CreatedAt.In(loc),
+			LastSeenAt: s.LastSeenAt.In(loc),
+			ExpiresAt:  s.ExpiresAt.In(loc),
+			Current:    s.ID == currentID,
+		})
+	}
+	return views, nil
+}
+
+// userLocation returns the timezone the current user sees times in.
+func (h *AccountHandler) userLocation(r *http.Request) (*time.Location, error) {
+	settings, err := h.settingsRepo.Get(middleware.GetUserID(r))
+	if err != nil {
+		return nil, err
+	}
+	return settings.Location(), nil
+}
+
+// revokeSession ends one of the user's sessions by ID. It reports the HTTP
+// status and message to send back when the request can't be honoured.
+func (h *AccountHandler) revokeSession(r *http.Request) (int, string) {
+	sessionID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		return http.StatusBadRequest, "Invalid session ID"
+	}
+
+	if current := middleware.GetSession(r); current != nil && current.ID == sessionID {
+		return http.StatusBadRequest, "Use logout to end the current session"
+	}
+
+	err = h.sessionRepo.Delete(sessionID, middleware.GetUserID(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, "Session not found"
+	}
+	if err != nil {
+		log.Printf("Failed to revoke session %d: %v", sessionID, err)
+		return http.StatusInternalServerError, "Failed to revoke session"
+	}
+	return http.StatusOK, ""
+}
+
+// revokeOtherSessions logs the user out everywhere except the current browser.
+func (h *AccountHandler) revokeOtherSessions(r *http.Request) (int64, error) {
+	currentID := 0
+	if current := middleware.GetSession(r); current != nil {
+		currentID = current.ID
+	}
+	return h.sessionRepo.DeleteOthers(middleware.GetUserID(r), currentID)
+}
+
+func (h *AccountHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		sessions, err := h.listSessions(r)
+		if err != nil {
+			http.Error(w, "Failed to load sessions", http.StatusInternalServerError)
+			return
+		}
+
+		data := map[string]interface{}{
+			"Title":     "Active Sessions",
+			"CSRFToken": middleware.CSRFToken(r),
+			"CSPNonce":  middleware.CSPNonce(r),
+			"Sessions":  sessions,
+			"Revoked":   r.URL.Query().Get("revoked"),
+		}
+		h.sessionsTmpl.ExecuteTemplate(w, "base", data)
+
+	case http.MethodDelete:
+		if status, msg := h.revokeSession(r); status != http.StatusOK {
+			http.Error(w, msg, status)
+			return
+		}
+
+		// Empty body so HTMX removes the row
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AccountHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n, err := h.revokeOtherSessions(r)
+	if err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/account/sessions?revoked="+strconv.FormatInt(n, 10), http.StatusSeeOther)
+}
+
+func (h *AccountHandler) SessionsAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		sessions, err := h.listSessions(r)
+		if err != nil {
+			http.Error(w, "Failed to load sessions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sessions": sessions,
+		})
+
+	case http.MethodDelete:
+		if status, msg := h.revokeSession(r); status != http.StatusOK {
+			http.Error(w, msg, status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AccountHandler) RevokeOtherSessionsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n, err := h.revokeOtherSessions(r)
+	if err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"revoked": n,
+	})
+}
+
+// Tokens lists the user's API tokens (GET), issues a new one (POST) or
+// revokes one (DELETE). A newly issued secret is shown exactly once.
+func (h *AccountHandler) Tokens(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		h.renderTokens(w, r, map[string]interface{}{})
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		scope := models.ScopeRead
+		if r.FormValue("scope") == models.ScopeReadWrite {
+			scope = models.ScopeReadWrite
+		}
+
+		token, err := h.apiTokenRepo.Create(userID, strings.TrimSpace(r.FormValue("name")), scope)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			h.renderTokens(w, r, map[string]interface{}{
+				"Error": err.Error(),
+			})
+			return
+		}
+
+		h.renderTokens(w, r, map[string]interface{}{
+			"NewToken": token,
+		})
+
+	case http.MethodDelete:
+		tokenID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "Invalid token ID", http.StatusBadRequest)
+			return
+		}
+
+		err = h.apiTokenRepo.Delete(tokenID, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to revoke API token %d: %v", tokenID, err)
+			http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+
+		// Empty body so HTMX removes the row
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AccountHandler) renderTokens(w http.ResponseWriter, r *http.Request, data map[string]interface{}) {
+	tokens, err := h.apiTokenRepo.ListByUser(middleware.GetUserID(r))
+	if err != nil {
+		http.Error(w, "Failed to load API tokens", http.StatusInternalServerError)
+		return
+	}
+
+	loc, err := h.userLocation(r)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
+	for i := range tokens {
+		tokens[i].CreatedAt = tokens[i].CreatedAt.In(loc)
+		if tokens[i].LastUsedAt != nil {
+			lastUsed := tokens[i].LastUsedAt.In(loc)
+			tokens[i].LastUsedAt = &lastUsed
+		}
+	}
+
+	data["Title"] = "API Tokens"
+	data["CSRFToken"] = middleware.CSRFToken(r)
+	data["CSPNonce"] = middleware.CSPNonce(r)
+	data["Tokens"] = tokens
+	h.tokensTmpl.ExecuteTemplate(w, "base", data)
+}
+
+// Settings shows (GET) and saves (POST) the user's preferences.
+func (h *AccountHandler) Settings(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+
+	settings, err := h.settingsRepo.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Title":     "Settings",
+		"CSRFToken": middleware.CSRFToken(r),
+		"CSPNonce":  middleware.CSPNonce(r),
+		"Settings":  settings,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data["Saved"] = r.URL.Query().Get("saved") == "true"
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		settings.EntryMode = r.FormValue("entry_mode")
+		settings.DailyAggregation = r.FormValue("daily_aggregation")
+		settings.Timezone = strings.TrimSpace(r.FormValue("timezone"))
+		settings.Unit = r.FormValue("unit")
+
+		if err := h.settingsRepo.Save(userID, settings); err != nil {
+			log.Printf("Failed to save settings for user %d: %v", userID, err)
+			w.WriteHeader(http.StatusBadRequest)
+			data["Error"] = "Failed to save settings: " + err.Error()
+			break
+		}
+
+		http.Redirect(w, r, "/account/settings?saved=true", http.StatusSeeOther)
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.settingsTmpl.ExecuteTemplate(w, "base", data)
+}
+
+// Data shows the download and restore page (GET) and restores an uploaded
+// archive into the account (POST).
+func (h *AccountHandler) Data(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{
+		"Title":     "Your Data",
+		"CSRFToken": middleware.CSRFToken(r),
+		"CSPNonce":  middleware.CSPNonce(r),
+		"Version":   models.ArchiveVersion,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data["Restored"] = r.URL.Query().Get("restored") == "true"
+		h.dataTmpl.ExecuteTemplate(w, "base", data)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fail := func(status int, message string) {
+		w.WriteHeader(status)
+		data["Error"] = message
+		h.dataTmpl.ExecuteTemplate(w, "base", data)
+	}
+
+	allowSlowUpload(w)
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	file, _, err := r.FormFile("archive")
+	if err != nil {
+		fail(http.StatusBadRequest, "Choose an archive to restore")
+		return
+	}
+	defer file.Close()
+
+	archive, err := decodeArchive(file)
+	if err != nil {
+		fail(http.StatusBadRequest, "Couldn't read the archive: "+err.Error())
+		return
+	}
+
+	if status, msg := h.restoreArchive(r, archive); status != http.StatusOK {
+		fail(status, msg)
+		return
+	}
+
+	http.Redirect(w, r, "/account/data?restored=true", http.StatusSeeOther)
+}
+
+// DataExport downloads the user's account archive.
+func (h *AccountHandler) DataExport(w http.ResponseWriter, r *http.Request) {
+	archive, err := h.archiveRepo.Export(middleware.GetUserID(r))
+	if err != nil {
+		log.Printf("Failed to export account %d: %v", middleware.GetUserID(r), err)
+		http.Error(w, "Failed to export account", http.StatusInternalServerError)
+		return
+	}
+	h.writeArchive(w, r, archive)
+}
+
+// ExportAPI is DataExport for API clients, with JSON errors.
+func (h *AccountHandler) ExportAPI(w http.ResponseWriter, r *http.Request) {
+	// The archive holds everything in the account, so a read-only token
+	// isn't enough to take it away
+	if token := middleware.GetAPIToken(r); token != nil && !token.CanWrite() {
+		writeJSONError(w, http.StatusForbidden, "exporting the account needs a read-write token")
+		return
+	}
+
+	archive, err := h.archiveRepo.Export(middleware.GetUserID(r))
+	if err != nil {
+		log.Printf("Failed to export account %d: %v", middleware.GetUserID(r), err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to export account")
+		return
+	}
+	h.writeArchive(w, r, archive)
+}
+
+// ImportAPI restores an archive sent as the request body.
+func (h *AccountHandler) ImportAPI(w http.ResponseWriter, r *http.Request) {
+	allowSlowUpload(w)
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	archive, err := decodeArchive(r.Body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid archive: "+err.Error())
+		return
+	}
+
+	if status, msg := h.restoreArchive(r, archive); status != http.StatusOK {
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"weights": len(archive.Weights),
+		"goals":   len(archive.Goals),
+	})
+}
+
+func (h *AccountHandler) writeArchive(w http.ResponseWriter, r *http.Request, archive *models.Archive) {
+	loc, err := h.userLocation(r)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	filename := "weight-tracker-" + time.Now().In(loc).Format("2006-01-02") + ".json"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(archive); err != nil {
+		log.Printf("Failed to write archive for user %d: %v", middleware.GetUserID(r), err)
+	}
+}
+
+// restoreArchive loads archive into the current account. It reports the HTTP
+// status and message to send back when the archive can't be restored.
+func (h *AccountHandler) restoreArchive(r *http.Request, archive *models.Archive) (int, string) {
+	if err := archive.Validate(); err != nil {
+		return http.StatusUnprocessableEntity, "The archive can't be restored: " + err.Error()
+	}
+
+	userID := middleware.GetUserID(r)
+	err := h.archiveRepo.Restore(userID, archive)
+	switch {
+	case errors.Is(err, models.ErrAccountNotEmpty):
+		return http.StatusConflict, "Archives can only be restored into an account without weights or goals"
+	case err != nil:
+		log.Printf("Failed to restore archive for user %d: %v", userID, err)
+		return http.StatusInternalServerError, "Failed to restore archive"
+	}
+	return http.StatusOK, ""
+}
+
+func decodeArchive(r io.Reader) (*models.Archive, error) {
+	var archive models.Archive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, fmt.Errorf("larger than %d MB", maxUploadBytes>>20)
+		}
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// reauthenticate runs check on a password or code the signed-in user entered
+// to confirm a sensitive change. Attempts count towards the login throttle,
+// so a stolen session can't be used to guess the password. check returns the
+// message to show when the credentials are wrong. reauthenticate returns
+// http.StatusOK once they are right, or the status and message to answer
+// with; a throttled request also gets its Retry-After header.
+func (h *AccountHandler) reauthenticate(w http.ResponseWriter, r *http.Request, check func(user *models.User) (string, error)) (int, string) {
+	user := middleware.GetUser(r)
+	if user == nil {
+		return http.StatusUnauthorized, "Sign in again to continue"
+	}
+
+	ip := middleware.ClientIP(r)
+	wait, err := h.throttle.Reserve(ip, user.Username, time.Now())
+	if err != nil {
+		log.Printf("Failed to check login throttle: %v", err)
+		return http.StatusInternalServerError, "Failed to check your password, please try again"
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return http.StatusTooManyRequests, tooManyAttemptsMessage(wait)
+	}
+
+	failure, err := check(user)
+	if err != nil {
+		log.Printf("Failed to check credentials for user %d: %v", user.ID, err)
+		if err := h.throttle.Release(ip, user.Username); err != nil {
+			log.Printf("Failed to release login attempt for %s: %v", user.Username, err)
+		}
+		return http.StatusInternalServerError, "Failed to check your password, please try again"
+	}
+	if failure != "" {
+		recordLoginFailure(h.throttle, ip, user.Username)
+		return http.StatusForbidden, failure
+	}
+
+	if err := h.throttle.RecordSuccess(ip, user.Username); err != nil {
+		log.Printf("Failed to clear login failures for %s: %v", user.Username, err)
+	}
+	return http.StatusOK, ""
+}
+
+// checkPassword is a reauthenticate check for the account password.
+func (h *AccountHandler) checkPassword(password, failure string) func(user *models.User) (string, error) {
+	return func(user *models.User) (string, error) {
+		if !h.userRepo.VerifyPassword(user, password) {
+			return failure, nil
+		}
+		return "", nil
+	}
+}
+
+// deletionGraceDays are the grace periods offered before an account is
+// deleted. During one the account is disabled but signing in restores it;
+// 0 deletes it straight away.
+var deletionGraceDays = []int{0, 7, 30}
+
+// deleteAccount checks the user's password and then deletes the account or
+// schedules its deletion. It returns when the account will be deleted, nil
+// if it already was, or the HTTP status and message to send back when the
+// request can't be honoured.
+func (h *AccountHandler) deleteAccount(w http.ResponseWriter, r *http.Request, password string, graceDays int) (*time.Time, int, string) {
+	if status, msg := h.reauthenticate(w, r, h.checkPassword(password, "Incorrect password")); status != http.StatusOK {
+		return nil, status, msg
+	}
+	user := middleware.GetUser(r)
+
+	valid := false
+	for _, days := range deletionGraceDays {
+		valid = valid || days == graceDays
+	}
+	if !valid {
+		return nil, http.StatusBadRequest, "Invalid grace period"
+	}
+
+	if graceDays == 0 {
+		if err := h.userRepo.Delete(user.ID); err != nil {
+			log.Printf("Failed to delete user %d: %v", user.ID, err)
+			return nil, http.StatusInternalServerError, "Failed to delete account"
+		}
+		log.Printf("Deleted user %d", user.ID)
+		return nil, http.StatusOK, ""
+	}
+
+	deleteAfter := time.Now().AddDate(0, 0, graceDays)
+	if err := h.userRepo.ScheduleDeletion(user.ID, deleteAfter); err != nil {
+		log.Printf("Failed to schedule deletion of user %d: %v", user.ID, err)
+		return nil, http.StatusInternalServerError, "Failed to delete account"
+	}
+	log.Printf("Scheduled deletion of user %d for %s", user.ID, deleteAfter.UTC().Format(time.RFC3339))
+	return &deleteAfter, http.StatusOK, ""
+}
+
+// DeleteAccount shows the deletion form (GET) and deletes the account or
+// schedules its deletion (POST), then signs the browser out.
+func (h *AccountHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{
+		"Title":     "Delete Account",
+		"CSRFToken": middleware.CSRFToken(r),
+		"CSPNonce":  middleware.CSPNonce(r),
+		"GraceDays": deletionGraceDays,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data["Restored"] = r.URL.Query().Get("restored") == "true"
+		h.deleteTmpl.ExecuteTemplate(w, "base", data)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	graceDays, err := strconv.Atoi(r.FormValue("grace_days"))
+	if err != nil {
+		graceDays = -1
+	}
+
+	deleteAfter, status, msg := h.deleteAccount(w, r, r.FormValue("password"), graceDays)
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		data["Error"] = msg
+		h.deleteTmpl.ExecuteTemplate(w, "base", data)
+		return
+	}
+
+	// The account's sessions are gone; drop the cookie too
+	h.cookies.Clear(w, middleware.SessionCookieName)
+
+	target := "/login?deleted=true"
+	if deleteAfter != nil {
+		loc, err := h.userLocation(r)
+		if err != nil {
+			loc = time.UTC
+		}
+		target = "/login?delete_after=" + deleteAfter.In(loc).Format("2006-01-02")
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// deleteAccountRequest is the body of DELETE /api/v1/account.
+type deleteAccountRequest struct {
+	Password  string `json:"password"`
+	GraceDays int    `json:"grace_days"`
+}
+
+// DeleteAccountAPI is DeleteAccount for API clients. The password is
+// required even with a token.
+func (h *AccountHandler) DeleteAccountAPI(w http.ResponseWriter, r *http.Request) {
+	var req deleteAccountRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	deleteAfter, status, msg := h.deleteAccount(w, r, req.Password, req.GraceDays)
+	if status != http.StatusOK {
+		writeJSONError(w, status, msg)
+		return
+	}
+
+	if deleteAfter == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": true})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"deleted":      false,
+		"delete_after": deleteAfter.UTC(),
+	})
+}
+
+// ChangePassword shows (GET) and handles (POST) the change password form.
+// A successful change signs out every other session.
+func (h *AccountHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{
+		"Title":             "Change Password",
+		"CSRFToken":         middleware.CSRFToken(r),
+		"CSPNonce":          middleware.CSPNonce(r),
+		"MinPasswordLength": models.MinPasswordLength,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data["Changed"] = r.URL.Query().Get("changed") == "true"
+		h.passwordTmpl.ExecuteTemplate(w, "base", data)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fail := func(status int, message string) {
+		w.WriteHeader(status)
+		data["Error"] = message
+		h.passwordTmpl.ExecuteTemplate(w, "base", data)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	if status, msg := h.reauthenticate(w, r, h.checkPassword(r.FormValue("current_password"), "Current password is incorrect")); status != http.StatusOK {
+		fail(status, msg)
+		return
+	}
+	user := middleware.GetUser(r)
+
+	password := r.FormValue("new_password")
+	if password != r.FormValue("confirm_password") {
+		fail(http.StatusBadRequest, "New passwords do not match")
+		return
+	}
+	if err := models.ValidatePassword(password); err != nil {
+		fail(http.StatusBadRequest, "New "+err.Error())
+		return
+	}
+
+	if err := h.userRepo.UpdatePassword(user.ID, password); err != nil {
+		log.Printf("Failed to change password for user %d: %v", user.ID, err)
+		fail(http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+
+	if _, err := h.revokeOtherSessions(r); err != nil {
+		log.Printf("Failed to revoke sessions for user %d: %v", user.ID, err)
+	}
+
+	http.Redirect(w, r, "/account/password?changed=true", http.StatusSeeOther)
+}
+
+// twoFactorIssuer names this app in authenticator apps.
+const twoFactorIssuer = "Weight Tracker"
+
+// TwoFactor shows the user's two-factor status (GET) and handles the form
+// actions (POST): begin and enable enrol a new authenticator app, disable
+// and regenerate need the password and a current code.
+func (h *AccountHandler) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	data := map[string]interface{}{
+		"Title":     "Two-Factor Authentication",
+		"CSRFToken": middleware.CSRFToken(r),
+		"CSPNonce":  middleware.CSPNonce(r),
+	}
+
+	// render fills in the current enrolment, so the page reflects whatever
+	// the action changed.
+	render := func(status int) {
+		enrolment, err := h.twoFactorRepo.Get(user.ID)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Failed to load two-factor status for user %d: %v", user.ID, err)
+			http.Error(w, "Failed to load two-factor status", http.StatusInternalServerError)
+			return
+		}
+
+		if enrolment != nil && enrolment.IsEnabled() {
+			remaining, err := h.twoFactorRepo.RemainingRecoveryCodes(user.ID)
+			if err != nil {
+				log.Printf("Failed to count recovery codes for user %d: %v", user.ID, err)
+			}
+			data["Enabled"] = true
+			data["EnabledAt"] = enrolment.EnabledAt
+			data["RemainingRecoveryCodes"] = remaining
+		} else if enrolment != nil {
+			data["Secret"] = enrolment.Secret
+			data["URI"] = template.URL(totp.URI(twoFactorIssuer, user.Username, enrolment.Secret))
+		}
+
+		w.WriteHeader(status)
+		h.twoFactorTmpl.ExecuteTemplate(w, "base", data)
+	}
+	fail := func(status int, message string) {
+		data["Error"] = message
+		render(status)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		data["RecoveryUsed"] = r.URL.Query().Get("recovery_used") == "true"
+		render(http.StatusOK)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	code := strings.TrimSpace(r.FormValue("code"))
+	switch r.FormValue("action") {
+	case "begin":
+		if _, err := h.twoFactorRepo.BeginEnrolment(user.ID); err != nil {
+			if errors.Is(err, models.ErrTwoFactorEnabled) {
+				fail(http.StatusConflict, "Two-factor authentication is already enabled")
+				return
+			}
+			log.Printf("Failed to begin two-factor enrolment for user %d: %v", user.ID, err)
+			fail(http.StatusInternalServerError, "Failed to set up two-factor authentication")
+			return
+		}
+		render(http.StatusOK)
+
+	case "enable":
+		codes, err := h.twoFactorRepo.Enable(user.ID, code, time.Now())
+		if errors.Is(err, models.ErrInvalidTwoFactorCode) {
+			fail(http.StatusBadRequest, "Invalid code, check your device's clock and try again")
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to enable two-factor authentication for user %d: %v", user.ID, err)
+			fail(http.StatusInternalServerError, "Failed to enable two-factor authentication")
+			return
+		}
+		log.Printf("Enabled two-factor authentication for user %d", user.ID)
+		data["RecoveryCodes"] = codes
+		render(http.StatusOK)
+
+	case "disable", "regenerate":
+		status, msg := h.reauthenticate(w, r, func(user *models.User) (string, error) {
+			if !h.userRepo.VerifyPassword(user, r.FormValue("password")) {
+				return "Incorrect password", nil
+			}
+			if _, err := h.twoFactorRepo.Verify(user.ID, code, time.Now()); err != nil {
+				if errors.Is(err, models.ErrInvalidTwoFactorCode) {
+					return "Invalid code", nil
+				}
+				return "", err
+			}
+			return "", nil
+		})
+		if status != http.StatusOK {
+			fail(status, msg)
+			return
+		}
+
+		if r.FormValue("action") == "disable" {
+			if err := h.twoFactorRepo.Disable(user.ID); err != nil {
+				log.Printf("Failed to disable two-factor authentication for user %d: %v", user.ID, err)
+				fail(http.StatusInternalServerError, "Failed to disable two-factor authentication")
+				return
+			}
+			log.Printf("Disabled two-factor authentication for user %d", user.ID)
+			data["Disabled"] = true
+			render(http.StatusOK)
+			return
+		}
+
+		codes, err := h.twoFactorRepo.RegenerateRecoveryCodes(user.ID)
+		if err != nil {
+			log.Printf("Failed to regenerate recovery codes for user %d: %v", user.ID, err)
+			fail(http.StatusInternalServerError, "Failed to generate new recovery codes")
+			return
+		}
+		data["RecoveryCodes"] = codes
+		render(http.StatusOK)
+
+	default:
+		fail(http.StatusBadRequest, "Unknown action")
+	}
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
+)
+
+func TestAPITokensOnlyReachAPI(t *testing.T) {
+	db := newTestDB(t)
+	server := newTestServer(db)
+	alice := mustCreateUser(t, db, "alice")
+
+	tokens := models.NewAPITokenRepository(db)
+	readWrite, err := tokens.Create(alice.ID, "script", models.ScopeReadWrite)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	readOnly, err := tokens.Create(alice.ID, "dashboard", models.ScopeRead)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	mintForm := url.Values{"name": {"minted"}, "scope": {models.ScopeReadWrite}}.Encode()
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		want   int
+	}{
+		{"API read", http.MethodGet, "/api/v1/weights", "", readOnly.Token, http.StatusOK},
+		{"mint token", http.MethodPost, "/account/tokens", mintForm, readWrite.Token, http.StatusForbidden},
+		{"list tokens", http.MethodGet, "/account/tokens", "", readWrite.Token, http.StatusUnauthorized},
+		{"sessions", http.MethodGet, "/account/sessions", "", readWrite.Token, http.StatusUnauthorized},
+		{"two-factor", http.MethodGet, "/account/two-factor", "", readWrite.Token, http.StatusUnauthorized},
+		{"password", http.MethodGet, "/account/password", "", readWrite.Token, http.StatusUnauthorized},
+		{"delete", http.MethodGet, "/account/delete", "", readWrite.Token, http.StatusUnauthorized},
+		{"archive export", http.MethodGet, "/account/data/export", "", readOnly.Token, http.StatusUnauthorized},
+		{"API archive export, read-only", http.MethodGet, "/api/v1/account/export", "", readOnly.Token, http.StatusForbidden},
+		{"API archive export, read-write", http.MethodGet, "/api/v1/account/export", "", readWrite.Token, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		if tt.body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	list, err := tokens.ListByUser(alice.ID)
+	if err != nil {
+		t.Fatalf("list tokens: %v", err)
+	}
+	if len(list) != 2 {
+		t.Errorf("got %d tokens, want the 2 created by the test", len(list))
+	}
+}
+
+func TestBearerHeaderFallsBackToSession(t *testing.T) {
+	db := newTestDB(t)
+	server := newTestServer(db)
+	alice := mustCreateUser(t, db, "alice")
+
+	session, err := models.NewSessionRepository(db).Create(alice.ID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/account/sessions", nil)
+	req.Header.Set("Authorization", "Bearer wt_unknown")
+	req.AddCookie(&http.Cookie{Name: middleware.SessionCookieName, Value: session.Token})
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 from the session cookie", rec.Code)
+	}
+}
+
+// sendWithSession sends req from a signed-in browser at ip.
+func sendWithSession(server http.Handler, session *models.Session, ip string, req *http.Request) *httptest.ResponseRecorder {
+	req.RemoteAddr = ip + ":1234"
+	req.AddCookie(&http.Cookie{Name: middleware.SessionCookieName, Value: session.Token})
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+// pageCSRFToken loads the page at path and returns the CSRF token in it.
+func pageCSRFToken(t *testing.T, server http.Handler, session *models.Session, ip, path string) string {
+	t.Helper()
+
+	page := sendWithSession(server, session, ip, httptest.NewRequest(http.MethodGet, path, nil)).Body.String()
+	_, rest, ok := strings.Cut(page, `name="csrf_token" value="`)
+	token, _, _ := strings.Cut(rest, `"`)
+	if !ok || token == "" {
+		t.Fatalf("no CSRF token on %s", path)
+	}
+	return token
+}
+
+// sessionForm posts a form the way a signed-in browser does, with the CSRF
+// token from the page.
+func sessionForm(t *testing.T, server http.Handler, session *models.Session, ip, path string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form.Set(middleware.CSRFFieldName, pageCSRFToken(t, server, session, ip, path))
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return sendWithSession(server, session, ip, req)
+}
+
+func TestReauthenticationIsThrottled(t *testing.T) {
+	db := newTestDB(t)
+	server := newTestServer(db)
+	users := models.NewUserRepository(db)
+
+	tests := []struct {
+		name string
+		send func(t *testing.T, user *models.User, ip, password string) *httptest.ResponseRecorder
+	}{
+		{"change password", func(t *testing.T, user *models.User, ip, password string) *httptest.ResponseRecorder {
+			session, err := models.NewSessionRepository(db).Create(user.ID, "test", ip)
+			if err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			return sessionForm(t, server, session, ip, "/account/password", url.Values{
+				"current_password": {password},
+				"new_password":     {"a new password"},
+				"confirm_password": {"a new password"},
+			})
+		}},
+		{"delete account", func(t *testing.T, user *models.User, ip, password string) *httptest.ResponseRecorder {
+			session, err := models.NewSessionRepository(db).Create(user.ID, "test", ip)
+			if err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			return sessionForm(t, server, session, ip, "/account/delete", url.Values{
+				"password":   {password},
+				"grace_days": {"0"},
+			})
+		}},
+		{"delete account API", func(t *testing.T, user *models.User, ip, password string) *httptest.ResponseRecorder {
+			token, err := models.NewAPITokenRepository(db).Create(user.ID, "script", models.ScopeReadWrite)
+			if err != nil {
+				t.Fatalf("create token: %v", err)
+			}
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/account", strings.NewReader(`{"password": "`+password+`"}`))
+			req.RemoteAddr = ip + ":1234"
+			req.Header.Set("Authorization", "Bearer "+token.Token)
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			return rec
+		}},
+		{"disable two-factor", func(t *testing.T, user *models.User, ip, password string) *httptest.ResponseRecorder {
+			session, err := models.NewSessionRepository(db).Create(user.ID, "test", ip)
+			if err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			return sessionForm(t, server, session, ip, "/account/two-factor", url.Values{
+				"action":   {"disable"},
+				"password": {password},
+				"code":     {"000000"},
+			})
+		}},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := mustCreateUser(t, db, "user"+strconv.Itoa(i))
+			ip := "192.0.2." + strconv.Itoa(i+1)
+
+			if rec := tt.send(t, user, ip, "wrong password"); rec.Code != http.StatusForbidden {
+				t.Fatalf("wrong password: status = %d, want 403", rec.Code)
+			}
+
+			// The right password straight after a failure has to wait too
+			rec := tt.send(t, user, ip, "password123")
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("retry: status = %d, want 429", rec.Code)
+			}
+			if rec.Header().Get("Retry-After") == "" {
+				t.Error("retry: missing Retry-After")
+			}
+
+			stored, err := users.GetByID(user.ID)
+			if err != nil {
+				t.Fatalf("account is gone: %v", err)
+			}
+			if !users.VerifyPassword(stored, "password123") {
+				t.Error("password changed")
+			}
+		})
+	}
+}
+
+func TestReauthenticationClearsFailures(t *testing.T) {
+	db := newTestDB(t)
+	server := newTestServer(db)
+	users := models.NewUserRepository(db)
+	alice := mustCreateUser(t, db, "alice")
+
+	session, err := models.NewSessionRepository(db).Create(alice.ID, "test", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	change := func(current, next string) int {
+		return sessionForm(t, server, session, "192.0.2.1", "/account/password", url.Values{
+			"current_password": {current},
+			"new_password":     {next},
+			"confirm_password": {next},
+		}).Code
+	}
+
+	if status := change("password123", "a new password"); status != http.StatusSeeOther {
+		t.Fatalf("change: status = %d, want 303", status)
+	}
+	// A success leaves no backoff behind
+	if status := change("a new password", "another password"); status != http.StatusSeeOther {
+		t.Fatalf("second change: status = %d, want 303", status)
+	}
+
+	stored, err := users.GetByID(alice.ID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if !users.VerifyPassword(stored, "another password") {
+		t.Error("password wasn't changed")
+	}
+}
+
+func TestRevokeSessionOnlyFindsOwnSessions(t *testing.T) {
+	db := newTestDB(t)
+	server := newTestServer(db)
+	sessions := models.NewSessionRepository(db)
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+
+	current, err := sessions.Create(alice.ID, "laptop", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	phone, err := sessions.Create(alice.ID, "phone", "192.0.2.2")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	bobs, err := sessions.Create(bob.ID, "laptop", "192.0.2.3")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	token := pageCSRFToken(t, server, current, "192.0.2.1", "/account/sessions")
+
+	tests := []struct {
+		name string
+		id   int
+		want int
+	}{
+		{"another user's session", bobs.ID, http.StatusNotFound},
+		{"unknown session", bobs.ID + 100, http.StatusNotFound},
+		{"current session", current.ID, http.StatusBadRequest},
+		{"own session", phone.ID, http.StatusOK},
+		{"already revoked", phone.ID, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodDelete, "/account/sessions?id="+strconv.Itoa(tt.id), nil)
+		req.Header.Set(middleware.CSRFHeaderName, token)
+		if rec := sendWithSession(server, current, "192.0.2.1", req); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	if _, err := sessions.GetByToken(bobs.Token); err != nil {
+		t.Errorf("bob's session was revoked: %v", err)
+	}
+}
+
+func TestRevokeTokenOnlyFindsOwnTokens(t *testing.T) {
+	db := newTestDB(t)
+	server := newTestServer(db)
+	tokens := models.NewAPITokenRepository(db)
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+
+	session, err := models.NewSessionRepository(db).Create(alice.ID, "laptop", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	own, err := tokens.Create(alice.ID, "script", models.ScopeRead)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	bobs, err := tokens.Create(bob.ID, "script", models.ScopeRead)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	csrf := pageCSRFToken(t, server, session, "192.0.2.1", "/account/tokens")
+
+	tests := []struct {
+		name string
+		id   int
+		want int
+	}{
+		{"another user's token", bobs.ID, http.StatusNotFound},
+		{"unknown token", bobs.ID + 100, http.StatusNotFound},
+		{"own token", own.ID, http.StatusOK},
+		{"already revoked", own.ID, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodDelete, "/account/tokens?id="+strconv.Itoa(tt.id), nil)
+		req.Header.Set(middleware.CSRFHeaderName, csrf)
+		if rec := sendWithSession(server, session, "192.0.2.1", req); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	remaining, err := tokens.ListByUser(bob.ID)
+	if err != nil {
+		t.Fatalf("list tokens: %v", err)
+	}
+	if len(remaining) != 1 {
+		t.Errorf("bob has %d tokens, want 1", len(remaining))
+	}
+}
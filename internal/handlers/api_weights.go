@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
+)
+
+const (
+	defaultWeightPageSize = 50
+	maxWeightPageSize     = 1000
+)
+
+// WeightAPIHandler serves the versioned JSON API for weight entries.
+type WeightAPIHandler struct {
+	weightRepo   *models.WeightRepository
+	settingsRepo *models.SettingsRepository
+}
+
+func NewWeightAPIHandler(db *sql.DB) *WeightAPIHandler {
+	return &WeightAPIHandler{
+		weightRepo:   models.NewWeightRepository(db),
+		settingsRepo: models.NewSettingsRepository(db),
+	}
+}
+
+// weightInput is the request body for creating or updating an entry. Fields
+// are pointers so updates can tell "absent" from "zero". A weight is given
+// either as weight_kg or as weight in unit, which defaults to the user's
+// display unit; stones are decimal.
+type weightInput struct {
+	WeightKg   *float64   `json:"weight_kg"`
+	Weight     *float64   `json:"weight"`
+	Unit       *string    `json:"unit"`
+	RecordedAt *time.Time `json:"recorded_at"`
+	Notes      *string    `json:"notes"`
+}
+
+// validate checks the input and resolves weight/unit into WeightKg.
+func (in *weightInput) validate(requireWeight bool, defaultUnit string) map[string]string {
+	fields := map[string]string{}
+
+	unit := defaultUnit
+	if in.Unit != nil {
+		unit = *in.Unit
+		if !models.ValidUnit(unit) {
+			fields["unit"] = "must be one of kg, lb or st"
+		}
+	}
+
+	field := "weight_kg"
+	if in.Weight != nil {
+		field = "weight"
+		if in.WeightKg != nil {
+			fields["weight"] = "give either weight or weight_kg, not both"
+		} else if models.ValidUnit(unit) {
+			kg := models.ToKg(*in.Weight, unit)
+			in.WeightKg = &kg
+		}
+	} else if in.WeightKg != nil {
+		unit = models.UnitKg
+	}
+
+	if in.WeightKg == nil {
+		if requireWeight && len(fields) == 0 {
+			fields["weight"] = "is required"
+		}
+	} else if *in.WeightKg < models.MinWeightKg || *in.WeightKg > models.MaxWeightKg {
+		fields[field] = fmt.Sprintf("must be between %s and %s",
+			models.FormatWeight(models.MinWeightKg, unit), models.FormatWeight(models.MaxWeightKg, unit))
+	}
+
+	if in.RecordedAt != nil {
+		if err := models.ValidateRecordedAt(*in.RecordedAt); err != nil {
+			fields["recorded_at"] = err.Error()
+		}
+	}
+
+	if in.Notes != nil && len(*in.Notes) > models.MaxNotesLength {
+		fields["notes"] = fmt.Sprintf("must be at most %d characters", models.MaxNotesLength)
+	}
+
+	return fields
+}
+
+// weightResponse is an entry as returned by the API: the stored kilograms
+// plus the weight in the user's display unit.
+type weightResponse struct {
+	models.Weight
+	Value float64 `json:"weight"`
+	Unit  string  `json:"unit"`
+}
+
+func newWeightResponse(weight models.Weight, settings *models.Settings) weightResponse {
+	return weightResponse{
+		Weight: weight,
+		Value:  models.FromKg(weight.WeightKg, settings.Unit),
+		Unit:   settings.Unit,
+	}
+}
+
+type weightListResponse struct {
+	Weights []weightResponse `json:"weights"`
+	Total   int              `json:"total"`
+	Limit   int              `json:"limit"`
+	Offset  int              `json:"offset"`
+}
+
+// Weights handles the collection: GET lists entries, POST logs a new one.
+func (h *WeightAPIHandler) Weights(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, r)
+	case http.MethodPost:
+		h.create(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Weight handles a single entry addressed by /api/v1/weights/{id}.
+func (h *WeightAPIHandler) Weight(w http.ResponseWriter, r *http.Request) {
+	weightID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "weight not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r, weightID)
+	case http.MethodPut, http.MethodPatch:
+		h.update(w, r, weightID)
+	case http.MethodDelete:
+		h.delete(w, r, weightID)
+	default:
+		w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *WeightAPIHandler) list(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+
+	limit, offset := defaultWeightPageSize, 0
+	fields := map[string]string{}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxWeightPageSize {
+			fields["limit"] = fmt.Sprintf("must be between 1 and %d", maxWeightPageSize)
+		}
+		limit = n
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			fields["offset"] = "must be a non-negative integer"
+		}
+		offset = n
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	settings, ok := h.loadSettings(w, userID)
+	if !ok {
+		return
+	}
+
+	weights, err := h.weightRepo.List(userID, limit, offset)
+	if err != nil {
+		log.Printf("Failed to list weights for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch weights")
+		return
+	}
+
+	total, err := h.weightRepo.Count(userID)
+	if err != nil {
+		log.Printf("Failed to count weights for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch weights")
+		return
+	}
+
+	responses := make([]weightResponse, 0, len(weights))
+	for _, weight := range weights {
+		responses = append(responses, newWeightResponse(weight, settings))
+	}
+	writeJSON(w, http.StatusOK, weightListResponse{
+		Weights: responses,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	})
+}
+
+func (h *WeightAPIHandler) get(w http.ResponseWriter, r *http.Request, weightID int) {
+	userID := middleware.GetUserID(r)
+	settings, ok := h.loadSettings(w, userID)
+	if !ok {
+		return
+	}
+
+	weight, err := h.weightRepo.GetByID(weightID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "weight not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch weight")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newWeightResponse(*weight, settings))
+}
+
+func (h *WeightAPIHandler) create(w http.ResponseWriter, r *http.Request) {
+	var in weightInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	settings, ok := h.loadSettings(w, userID)
+	if !ok {
+		return
+	}
+
+	if fields := in.validate(true, settings.Unit); len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	// Days are bucketed in the user's timezone whatever offset the client sent
+	weight := &models.Weight{
+		UserID:     userID,
+		WeightKg:   *in.WeightKg,
+		RecordedAt: time.Now().In(settings.Location()),
+	}
+	if in.RecordedAt != nil {
+		weight.RecordedAt = in.RecordedAt.In(settings.Location())
+	}
+	if in.Notes != nil {
+		weight.Notes = *in.Notes
+	}
+
+	created, err := saveWeight(h.weightRepo, settings, weight)
+	if err != nil {
+		log.Printf("Failed to save weight for user %d: %v", weight.UserID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to save weight")
+		return
+	}
+
+	// Re-read so timestamps filled in by the database are returned
+	saved, err := h.weightRepo.GetByID(weight.ID, weight.UserID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch weight")
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/weights/%d", saved.ID))
+	writeJSON(w, status, newWeightResponse(*saved, settings))
+}
+
+func (h *WeightAPIHandler) update(w http.ResponseWriter, r *http.Request, weightID int) {
+	userID := middleware.GetUserID(r)
+	settings, ok := h.loadSettings(w, userID)
+	if !ok {
+		return
+	}
+
+	weight, err := h.weightRepo.GetByID(weightID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "weight not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch weight")
+		return
+	}
+
+	var in weightInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	// PUT replaces the reading and must carry a weight; PATCH may omit it
+	if fields := in.validate(r.Method == http.MethodPut, settings.Unit); len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	// Keep one entry per day when an entry is moved to another date, with
+	// days taken in the user's timezone
+	if in.RecordedAt != nil {
+		loc := settings.Location()
+		recordedAt := in.RecordedAt.In(loc)
+		movedDay := !models.StartOfDay(recordedAt).Equal(models.StartOfDay(weight.RecordedAt.In(loc)))
+		if !settings.AllowsMultiplePerDay() && movedDay {
+			if other, err := h.weightRepo.GetByDate(userID, recordedAt); err == nil && other.ID != weight.ID {
+				writeValidationError(w, map[string]string{
+					"recorded_at": "there is already an entry for " + recordedAt.Format("2006-01-02"),
+				})
+				return
+			}
+		}
+		weight.RecordedAt = recordedAt
+	}
+
+	if in.WeightKg != nil {
+		weight.WeightKg = *in.WeightKg
+	}
+	if in.Notes != nil {
+		weight.Notes = *in.Notes
+	}
+
+	if err := h.weightRepo.Update(weight); err != nil {
+		log.Printf("Failed to update weight %d: %v", weightID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to update weight")
+		return
+	}
+
+	updated, err := h.weightRepo.GetByID(weightID, userID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch weight")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newWeightResponse(*updated, settings))
+}
+
+func (h *WeightAPIHandler) delete(w http.ResponseWriter, r *http.Request, weightID int) {
+	userID := middleware.GetUserID(r)
+
+	if _, err := h.weightRepo.GetByID(weightID, userID); errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "weight not found")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to fetch weight")
+		return
+	}
+
+	if err := h.weightRepo.Delete(weightID, userID); err != nil {
+		log.Printf("Failed to delete weight %d: %v", weightID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to delete weight")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadSettings fetches the user's settings, writing an error response if it
+// can't.
+func (h *WeightAPIHandler) loadSettings(w http.ResponseWriter, userID int) (*models.Settings, bool) {
+	settings, err := h.settingsRepo.Get(userID)
+	if err != nil {
+		log.Printf("Failed to load settings for user %d: %v", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to load settings")
+		return nil, false
+	}
+	return settings, true
+}
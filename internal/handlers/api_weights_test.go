@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"weight-tracker/internal/models"
+)
+
+// newAPIToken issues a read-write token for the user.
+func newAPIToken(t *testing.T, db *sql.DB, user *models.User) string {
+	t.Helper()
+
+	token, err := models.NewAPITokenRepository(db).Create(user.ID, "test", models.ScopeReadWrite)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	return token.Token
+}
+
+// apiRequest sends a JSON request with the token and decodes the response
+// body into out, if given.
+func apiRequest(t *testing.T, server http.Handler, token, method, path, body string, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	if out != nil && rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body, err)
+		}
+	}
+	return rec
+}
+
+func TestWeightAPIKeepsOneEntryPerDay(t *testing.T) {
+	db := newTestDB(t)
+	server := newTestServer(db)
+	alice := mustCreateUser(t, db, "alice")
+	token := newAPIToken(t, db, alice)
+
+	weights := models.NewWeightRepository(db)
+	monday := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	first := &models.Weight{UserID: alice.ID, WeightKg: 80, RecordedAt: monday}
+	second := &models.Weight{UserID: alice.ID, WeightKg: 81, RecordedAt: monday.AddDate(0, 0, 1)}
+	for _, w := range []*models.Weight{first, second} {
+		if err := weights.Create(w); err != nil {
+			t.Fatalf("create weight: %v", err)
+		}
+	}
+	path := "/api/v1/weights/" + strconv.Itoa(second.ID)
+
+	for _, method := range []string{http.MethodPut, http.MethodPatch} {
+		var body apiError
+		rec := apiRequest(t, server, token, method, path, `{"weight_kg": 81, "recorded_at": "2024-01-01T20:00:00Z"}`, &body)
+		if rec.Code != http.StatusUnprocessableEntity || body.Fields["recorded_at"] == "" {
+			t.Errorf("%s onto a logged day: status = %d, body %s; want 422 with a recorded_at error", method, rec.Code, rec.Body)
+		}
+	}
+
+	// Moving within its own day, or to a free day, is fine
+	for _, at := range []string{"2024-01-02T19:00:00Z", "2024-01-03T08:00:00Z"} {
+		if rec := apiRequest(t, server, token, http.MethodPatch, path, `{"recorded_at": "`+at+`"}`, nil); rec.Code != http.StatusOK {
+			t.Errorf("move to %s: status = %d, want 200: %s", at, rec.Code, rec.Body)
+		}
+	}
+
+	// Several readings a day are allowed in multiple mode
+	settings := models.DefaultSettings()
+	settings.EntryMode = models.EntryModeMultiple
+	if err := models.NewSettingsRepository(db).Save(alice.ID, settings); err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+	if rec := apiRequest(t, server, token, http.MethodPatch, path, `{"recorded_at": "2024-01-01T20:00:00Z"}`, nil); rec.Code != http.StatusOK {
+		t.Errorf("multiple mode: status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestWeightAPICRUD(t *testing.T) {
+	db := newTestDB(t)
+	server := newTestServer(db)
+	alice := mustCreateUser(t, db, "alice")
+	token := newAPIToken(t, db, alice)
+
+	var created weightResponse
+	rec := apiRequest(t, server, token, http.MethodPost, "/api/v1/weights",
+		`{"weight_kg": 80, "notes": "morning", "recorded_at": "2024-01-01T08:00:00Z"}`, &created)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want 201: %s", rec.Code, rec.Body)
+	}
+	path := "/api/v1/weights/" + strconv.Itoa(created.ID)
+	if got := rec.Header().Get("Location"); got != path {
+		t.Errorf("Location = %q, want %q", got, path)
+	}
+
+	var fetched weightResponse
+	if rec := apiRequest(t, server, token, http.MethodGet, path, "", &fetched); rec.Code != http.StatusOK ||
+		fetched.WeightKg != 80 || fetched.Notes != "morning" {
+		t.Errorf("get: status = %d, entry %+v", rec.Code, fetched)
+	}
+
+	// PUT replaces the entry, so it needs a weight; PATCH keeps the old one
+	var invalid apiError
+	rec = apiRequest(t, server, token, http.MethodPut, path, `{"notes": "evening"}`, &invalid)
+	if rec.Code != http.StatusUnprocessableEntity || invalid.Fields["weight"] != "is required" {
+		t.Errorf("PUT without a weight: status = %d, body %s; want 422 asking for the weight", rec.Code, rec.Body)
+	}
+	var patched weightResponse
+	rec = apiRequest(t, server, token, http.MethodPatch, path, `{"notes": "evening"}`, &patched)
+	if rec.Code != http.StatusOK || patched.WeightKg != 80 || patched.Notes != "evening" {
+		t.Errorf("PATCH notes: status = %d, entry %+v", rec.Code, patched)
+	}
+	var replaced weightResponse
+	rec = apiRequest(t, server, token, http.MethodPut, path, `{"weight_kg": 81}`, &replaced)
+	if rec.Code != http.StatusOK || replaced.WeightKg != 81 || replaced.Notes != "evening" {
+		t.Errorf("PUT: status = %d, entry %+v", rec.Code, replaced)
+	}
+
+	for _, tt := range []struct {
+		method, path, allow string
+	}{
+		{http.MethodDelete, "/api/v1/weights", "GET, POST"},
+		{http.MethodPost, path, "GET, PUT, PATCH, DELETE"},
+	} {
+		rec := apiRequest(t, server, token, tt.method, tt.path, "", nil)
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != tt.allow {
+			t.Errorf("%s %s: status = %d, Allow %q; want 405 allowing %q", tt.method, tt.path, rec.Code, rec.Header().Get("Allow"), tt.allow)
+		}
+	}
+
+	if rec := apiRequest(t, server, token, http.MethodDelete, path, "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: status = %d, want 204", rec.Code)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+		if rec := apiRequest(t, server, token, method, path, `{"notes": ""}`, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("%s after delete: status = %d, want 404", method, rec.Code)
+		}
+	}
+	if rec := apiRequest(t, server, token, http.MethodGet, "/api/v1/weights/abc", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("non-numeric ID: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestWeightAPIValidationErrors(t *testing.T) {
+	db := newTestDB(t)
+	server := newTestServer(db)
+	alice := mustCreateUser(t, db, "alice")
+	token := newAPIToken(t, db, alice)
+
+	body := `{"weight_kg": 5, "unit": "stone", "notes": "` + strings.Repeat("a", models.MaxNotesLength+1) + `"}`
+	var got map[string]interface{}
+	rec := apiRequest(t, server, token, http.MethodPost, "/api/v1/weights", body, &got)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	want := map[string]interface{}{
+		"error": "validation failed",
+		"fields": map[string]interface{}{
+			"weight_kg": "must be between 20.0 kg and 500.0 kg",
+			"unit":      "must be one of kg, lb or st",
+			"notes":     "must be at most 500 characters",
+		},
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("body = %s, want %s", gotJSON, wantJSON)
+	}
+
+	if count, err := models.NewWeightRepository(db).Count(alice.ID); err != nil || count != 0 {
+		t.Errorf("stored %d entries (err %v), want none", count, err)
+	}
+}
+
+func TestWeightAPIIsolatesUsers(t *testing.T) {
+	db := newTestDB(t)
+	server := newTestServer(db)
+	alice := mustCreateUser(t, db, "alice")
+	bob := mustCreateUser(t, db, "bob")
+	bobToken := newAPIToken(t, db, bob)
+
+	weights := models.NewWeightRepository(db)
+	entry := &models.Weight{UserID: alice.ID, WeightKg: 80, Notes: "alice's", RecordedAt: time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)}
+	if err := weights.Create(entry); err != nil {
+		t.Fatalf("create weight: %v", err)
+	}
+	path := "/api/v1/weights/" + strconv.Itoa(entry.ID)
+
+	for _, tt := range []struct {
+		method, body string
+	}{
+		{http.MethodGet, ""},
+		{http.MethodPut, `{"weight_kg": 90}`},
+		{http.MethodPatch, `{"notes": "bob's"}`},
+		{http.MethodDelete, ""},
+	} {
+		if rec := apiRequest(t, server, bobToken, tt.method, path, tt.body, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("bob %s alice's entry: status = %d, want 404", tt.method, rec.Code)
+		}
+	}
+
+	var list weightListResponse
+	if rec := apiRequest(t, server, bobToken, http.MethodGet, "/api/v1/weights", "", &list); rec.Code != http.StatusOK || list.Total != 0 {
+		t.Errorf("bob's list: status = %d, %d entries; want none", rec.Code, list.Total)
+	}
+
+	stored, err := weights.GetByID(entry.ID, alice.ID)
+	if err != nil {
+		t.Fatalf("alice's entry is gone: %v", err)
+	}
+	if stored.WeightKg != 80 || stored.Notes != "alice's" {
+		t.Errorf("alice's entry changed to %+v", stored)
+	}
+}
@@ -2,25 +2,45 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"html/template"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"weight-tracker/internal/middleware"
 	"weight-tracker/internal/models"
 )
 
+// loginChallengeCookie carries a login between the password and two-factor
+// steps.
+const loginChallengeCookie = "login_challenge"
+
 type AuthHandler struct {
-	userRepo *models.UserRepository
-	tmpl     *template.Template
+	userRepo      *models.UserRepository
+	sessionRepo   *models.SessionRepository
+	resetRepo     *models.PasswordResetRepository
+	throttle      *models.LoginThrottleRepository
+	twoFactorRepo *models.TwoFactorRepository
+	cookies       middleware.Cookies
+	tmpl          *template.Template
 }
 
-func NewAuthHandler(db *sql.DB) *AuthHandler {
-	tmpl := template.Must(template.ParseGlob("templates/*.html"))
+func NewAuthHandler(db *sql.DB, loginPolicy models.LoginPolicy, cookies middleware.Cookies) *AuthHandler {
+	tmpl := template.Must(template.New("").Funcs(templateFuncs).ParseGlob("templates/*.html"))
 	tmpl = template.Must(tmpl.ParseGlob("templates/partials/*.html"))
 
 	return &AuthHandler{
-		userRepo: models.NewUserRepository(db),
-		tmpl:     tmpl,
+		userRepo:      models.NewUserRepository(db),
+		sessionRepo:   models.NewSessionRepository(db),
+		resetRepo:     models.NewPasswordResetRepository(db),
+		throttle:      models.NewLoginThrottleRepository(db, loginPolicy),
+		twoFactorRepo: models.NewTwoFactorRepository(db),
+		cookies:       cookies,
+		tmpl:          tmpl,
 	}
 }
 
@@ -28,8 +48,13 @@ func (h *AuthHandler) ShowLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		data := map[string]interface{}{
 			"Registered": r.URL.Query().Get("registered") == "true",
+			"Deleted":    r.URL.Query().Get("deleted") == "true",
+			"Reset":      r.URL.Query().Get("reset") == "true",
+		}
+		if day, err := time.Parse("2006-01-02", r.URL.Query().Get("delete_after")); err == nil {
+			data["DeleteAfter"] = day.Format("January 2, 2006")
 		}
-		h.tmpl.ExecuteTemplate(w, "login.html", data)
+		h.render(w, r, "login.html", data)
 		return
 	}
 
@@ -38,36 +63,84 @@ func (h *AuthHandler) ShowLogin(w http.ResponseWriter, r *http.Request) {
 	password := r.FormValue("password")
 
 	if username == "" || password == "" {
-		h.tmpl.ExecuteTemplate(w, "login.html", map[string]interface{}{
+		h.render(w, r, "login.html", map[string]interface{}{
 			"Error": "Username and password are required",
 		})
 		return
 	}
 
+	// Throttle guessing before spending time on bcrypt. The attempt counts
+	// as a failure until the password turns out to be right.
+	ip := middleware.ClientIP(r)
+	wait, err := h.throttle.Reserve(ip, username, time.Now())
+	if err != nil {
+		log.Printf("Failed to check login throttle: %v", err)
+		h.render(w, r, "login.html", map[string]interface{}{
+			"Error": "Failed to sign in, please try again",
+		})
+		return
+	}
+	if wait > 0 {
+		h.tooManyAttempts(w, r, wait)
+		return
+	}
+
 	user, err := h.userRepo.GetByUsername(username)
 	if err != nil || !h.userRepo.VerifyPassword(user, password) {
-		h.tmpl.ExecuteTemplate(w, "login.html", map[string]interface{}{
+		recordLoginFailure(h.throttle, ip, username)
+
+		h.render(w, r, "login.html", map[string]interface{}{
 			"Error": "Invalid username or password",
 		})
 		return
 	}
 
-	// Set session cookie (simplified - in production use secure session management)
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    "user_" + username, // Simplified - use proper session tokens
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-		Secure:   false, // Set to true in production with HTTPS
-	})
+	enabled, err := h.twoFactorRepo.IsEnabled(user.ID)
+	if err != nil {
+		log.Printf("Failed to check two-factor status for user %s: %v", username, err)
+		h.releaseAttempt(ip, username)
+		h.render(w, r, "login.html", map[string]interface{}{
+			"Error": "Failed to sign in, please try again",
+		})
+		return
+	}
+
+	// With two-factor authentication the session is only created after the
+	// second step. Failures aren't cleared yet so codes can't be guessed by
+	// repeating the password step; only this attempt is given back.
+	if enabled {
+		h.releaseAttempt(ip, username)
+		token, err := h.twoFactorRepo.CreateLoginChallenge(user.ID)
+		if err != nil {
+			log.Printf("Failed to start two-factor login for user %s: %v", username, err)
+			h.render(w, r, "login.html", map[string]interface{}{
+				"Error": "Failed to sign in, please try again",
+			})
+			return
+		}
+
+		h.cookies.Set(w, loginChallengeCookie, token, time.Now().Add(models.LoginChallengeTTL))
+		http.Redirect(w, r, "/login/verify", http.StatusSeeOther)
+		return
+	}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	if err := h.throttle.RecordSuccess(ip, username); err != nil {
+		log.Printf("Failed to clear login failures for %s: %v", username, err)
+	}
+	h.completeLogin(w, r, user, "login.html", "/")
 }
 
 func (h *AuthHandler) ShowRegister(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{
+		"MinPasswordLength": models.MinPasswordLength,
+	}
+	fail := func(message string) {
+		data["Error"] = message
+		h.render(w, r, "register.html", data)
+	}
+
 	if r.Method == http.MethodGet {
-		h.tmpl.ExecuteTemplate(w, "register.html", nil)
+		h.render(w, r, "register.html", data)
 		return
 	}
 
@@ -77,32 +150,24 @@ func (h *AuthHandler) ShowRegister(w http.ResponseWriter, r *http.Request) {
 	confirmPassword := r.FormValue("confirm_password")
 
 	if username == "" || password == "" {
-		h.tmpl.ExecuteTemplate(w, "register.html", map[string]interface{}{
-			"Error": "Username and password are required",
-		})
+		fail("Username and password are required")
 		return
 	}
 
 	if password != confirmPassword {
-		h.tmpl.ExecuteTemplate(w, "register.html", map[string]interface{}{
-			"Error": "Passwords do not match",
-		})
+		fail("Passwords do not match")
 		return
 	}
 
-	if len(password) < 6 {
-		h.tmpl.ExecuteTemplate(w, "register.html", map[string]interface{}{
-			"Error": "Password must be at least 6 characters",
-		})
+	if err := models.ValidatePassword(password); err != nil {
+		fail(errorMessage(err))
 		return
 	}
 
 	// Check if user already exists
 	_, err := h.userRepo.GetByUsername(username)
 	if err == nil {
-		h.tmpl.ExecuteTemplate(w, "register.html", map[string]interface{}{
-			"Error": "Username already exists",
-		})
+		fail("Username already exists")
 		return
 	}
 
@@ -117,9 +182,7 @@ func (h *AuthHandler) ShowRegister(w http.ResponseWriter, r *http.Request) {
 		} else if err.Error() == "database is locked" {
 			errorMsg = "Database busy, please try again"
 		}
-		h.tmpl.ExecuteTemplate(w, "register.html", map[string]interface{}{
-			"Error": errorMsg,
-		})
+		fail(errorMsg)
 		return
 	}
 
@@ -128,14 +191,234 @@ func (h *AuthHandler) ShowRegister(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	// Revoke the session on the server so the token can't be reused
+	if token := h.cookies.Get(r, middleware.SessionCookieName); token != "" {
+		if err := h.sessionRepo.DeleteByToken(token); err != nil {
+			log.Printf("Failed to revoke session: %v", err)
+		}
+	}
+
 	// Clear session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    "",
-		Path:     "/",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		HttpOnly: true,
-	})
+	h.cookies.Clear(w, middleware.SessionCookieName)
 
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
-}
\ No newline at end of file
+}
+
+// VerifyLogin is the second login step for accounts with two-factor
+// authentication: it asks for a code from the user's app or a recovery code.
+func (h *AuthHandler) VerifyLogin(w http.ResponseWriter, r *http.Request) {
+	challenge := h.cookies.Get(r, loginChallengeCookie)
+	if challenge == "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := h.twoFactorRepo.GetLoginChallenge(challenge)
+	if err != nil {
+		if !errors.Is(err, models.ErrLoginChallenge) {
+			log.Printf("Failed to look up login challenge: %v", err)
+		}
+		h.render(w, r, "login.html", map[string]interface{}{
+			"Error": "Your sign in timed out, please enter your password again",
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.render(w, r, "login_verify.html", nil)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fail := func(message string) {
+		h.render(w, r, "login_verify.html", map[string]interface{}{
+			"Error": message,
+		})
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		log.Printf("Failed to load user %d for two-factor login: %v", userID, err)
+		fail("Failed to sign in, please try again")
+		return
+	}
+
+	// Codes count towards the same throttle as passwords
+	ip := middleware.ClientIP(r)
+	wait, err := h.throttle.Reserve(ip, user.Username, time.Now())
+	if err != nil {
+		log.Printf("Failed to check login throttle: %v", err)
+		fail("Failed to sign in, please try again")
+		return
+	}
+	if wait > 0 {
+		h.tooManyAttempts(w, r, wait)
+		return
+	}
+
+	usedRecoveryCode, err := h.twoFactorRepo.Verify(user.ID, strings.TrimSpace(r.FormValue("code")), time.Now())
+	if errors.Is(err, models.ErrInvalidTwoFactorCode) {
+		recordLoginFailure(h.throttle, ip, user.Username)
+		fail("Invalid code")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to verify two-factor code for user %d: %v", user.ID, err)
+		h.releaseAttempt(ip, user.Username)
+		fail("Failed to sign in, please try again")
+		return
+	}
+
+	if err := h.twoFactorRepo.DeleteLoginChallenge(challenge); err != nil {
+		log.Printf("Failed to end login challenge: %v", err)
+	}
+	h.cookies.Clear(w, loginChallengeCookie)
+	if err := h.throttle.RecordSuccess(ip, user.Username); err != nil {
+		log.Printf("Failed to clear login failures for %s: %v", user.Username, err)
+	}
+
+	redirect := "/"
+	if usedRecoveryCode {
+		log.Printf("User %d signed in with a recovery code", user.ID)
+		redirect = "/account/two-factor?recovery_used=true"
+	}
+	h.completeLogin(w, r, user, "login_verify.html", redirect)
+}
+
+// completeLogin creates the session for a user who passed every login step
+// and sends them on to redirect. Errors are shown on page.
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, page, redirect string) {
+	// Logging in during the grace period cancels a scheduled deletion
+	if user.IsScheduledForDeletion() {
+		if err := h.userRepo.CancelDeletion(user.ID); err != nil {
+			log.Printf("Failed to cancel deletion of user %s: %v", user.Username, err)
+			h.render(w, r, page, map[string]interface{}{
+				"Error": "Failed to sign in, please try again",
+			})
+			return
+		}
+		redirect = "/account/delete?restored=true"
+	}
+
+	// Create a server-side session and hand the browser its opaque token
+	session, err := h.sessionRepo.Create(user.ID, r.UserAgent(), middleware.ClientIP(r))
+	if err != nil {
+		log.Printf("Failed to create session for user %s: %v", user.Username, err)
+		h.render(w, r, page, map[string]interface{}{
+			"Error": "Failed to sign in, please try again",
+		})
+		return
+	}
+
+	h.cookies.Set(w, middleware.SessionCookieName, session.Token, session.ExpiresAt)
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// render executes one of the standalone auth pages, adding the CSRF token
+// its form needs and the CSP nonce.
+func (h *AuthHandler) render(w http.ResponseWriter, r *http.Request, page string, data map[string]interface{}) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["CSRFToken"] = middleware.CSRFToken(r)
+	data["CSPNonce"] = middleware.CSPNonce(r)
+	h.tmpl.ExecuteTemplate(w, page, data)
+}
+
+// tooManyAttempts answers a throttled login with 429 and how long to wait.
+func (h *AuthHandler) tooManyAttempts(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+	h.render(w, r, "login.html", map[string]interface{}{
+		"Error": tooManyAttemptsMessage(wait),
+	})
+}
+
+// errorMessage turns a validation error into a sentence for the page.
+func errorMessage(err error) string {
+	message := err.Error()
+	return strings.ToUpper(message[:1]) + message[1:]
+}
+
+// tooManyAttemptsMessage tells a throttled user how long to wait.
+func tooManyAttemptsMessage(wait time.Duration) string {
+	if wait > time.Minute {
+		return fmt.Sprintf("Too many failed attempts. Try again in %d minutes.", int(math.Ceil(wait.Minutes())))
+	}
+	return "Too many failed attempts. Try again in a few seconds."
+}
+
+// recordLoginFailure counts a reserved attempt as failed and logs any
+// lockout it caused.
+func recordLoginFailure(throttle *models.LoginThrottleRepository, ip, username string) {
+	lockouts, err := throttle.RecordFailure(ip, username, time.Now())
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+	for _, l := range lockouts {
+		log.Printf("Locked out %s %q after %d failed logins from %s, until %s",
+			l.Kind, l.Value, l.Failures, l.IPAddress, l.LockedUntil.Format(time.RFC3339))
+	}
+}
+
+// releaseAttempt gives back a reserved login attempt that ended without a
+// verdict on the password or code.
+func (h *AuthHandler) releaseAttempt(ip, username string) {
+	if err := h.throttle.Release(ip, username); err != nil {
+		log.Printf("Failed to release login attempt for %s: %v", username, err)
+	}
+}
+
+// ResetPassword lets a user set a new password with a one-time code from an
+// administrator (see cmd/admin).
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{
+		"MinPasswordLength": models.MinPasswordLength,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.render(w, r, "reset_password.html", data)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fail := func(status int, message string) {
+		w.WriteHeader(status)
+		data["Error"] = message
+		h.render(w, r, "reset_password.html", data)
+	}
+
+	password := r.FormValue("password")
+	if password != r.FormValue("confirm_password") {
+		fail(http.StatusBadRequest, "Passwords do not match")
+		return
+	}
+	if err := models.ValidatePassword(password); err != nil {
+		fail(http.StatusBadRequest, errorMessage(err))
+		return
+	}
+
+	userID, err := h.resetRepo.Redeem(r.FormValue("code"), password)
+	if errors.Is(err, models.ErrInvalidResetCode) {
+		fail(http.StatusBadRequest, "That reset code is invalid or has expired")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to reset password: %v", err)
+		fail(http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	log.Printf("Password reset with a code for user %d", userID)
+	http.Redirect(w, r, "/login?reset=true", http.StatusSeeOther)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
+)
+
+func TestRegisterAppliesPasswordRules(t *testing.T) {
+	db := newTestDB(t)
+	handler := NewAuthHandler(db, testLoginPolicy, middleware.Cookies{})
+
+	short := strings.Repeat("a", models.MinPasswordLength-1)
+	form := url.Values{"username": {"alice"}, "password": {short}, "confirm_password": {short}}
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler.ShowRegister(rec, req)
+
+	want := errorMessage(models.ValidatePassword(short))
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("page doesn't show %q", want)
+	}
+	if _, err := models.NewUserRepository(db).GetByUsername("alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("user was created (err %v)", err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ShowRegister(rec, httptest.NewRequest(http.MethodGet, "/register", nil))
+	if !strings.Contains(rec.Body.String(), fmt.Sprintf(`minlength="%d"`, models.MinPasswordLength)) {
+		t.Error("form doesn't ask for the minimum password length")
+	}
+}
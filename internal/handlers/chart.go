@@ -3,22 +3,153 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strings"
 	"time"
 	"weight-tracker/internal/middleware"
 	"weight-tracker/internal/models"
 )
 
 type ChartHandler struct {
-	weightRepo *models.WeightRepository
+	weightRepo   *models.WeightRepository
+	goalRepo     *models.GoalRepository
+	settingsRepo *models.SettingsRepository
 }
 
 func NewChartHandler(db *sql.DB) *ChartHandler {
 	return &ChartHandler{
-		weightRepo: models.NewWeightRepository(db),
+		weightRepo:   models.NewWeightRepository(db),
+		goalRepo:     models.NewGoalRepository(db),
+		settingsRepo: models.NewSettingsRepository(db),
 	}
 }
 
+// Chart overlays, requested with ?overlays=average,trend,goal,projection
+const (
+	overlayAverage    = "average"
+	overlayTrend      = "trend"
+	overlayGoal       = "goal"
+	overlayProjection = "projection"
+)
+
+// projectionDays is how far past today the regression projection extends.
+const projectionDays = 30
+
+// chartDataset is a Chart.js line dataset. Missing points are null.
+type chartDataset struct {
+	Label           string     `json:"label"`
+	Data            []*float64 `json:"data"`
+	BorderColor     string     `json:"borderColor"`
+	BackgroundColor string     `json:"backgroundColor"`
+	Fill            bool       `json:"fill"`
+	Tension         float64    `json:"tension"`
+	PointRadius     int        `json:"pointRadius"`
+	BorderDash      []int      `json:"borderDash,omitempty"`
+	SpanGaps        bool       `json:"spanGaps,omitempty"`
+}
+
+// newOverlay returns an unfilled, pointless line dataset.
+func newOverlay(label, color string, points int) chartDataset {
+	return chartDataset{
+		Label:           label,
+		Data:            make([]*float64, points),
+		BorderColor:     color,
+		BackgroundColor: color,
+		PointRadius:     0,
+		SpanGaps:        true,
+	}
+}
+
+// parseOverlays reads the comma separated overlays parameter.
+func parseOverlays(r *http.Request) (map[string]bool, error) {
+	overlays := map[string]bool{}
+	for _, param := range r.URL.Query()["overlays"] {
+		for _, name := range strings.Split(param, ",") {
+			name = strings.TrimSpace(name)
+			switch name {
+			case "":
+			case overlayAverage, overlayTrend, overlayGoal, overlayProjection:
+				overlays[name] = true
+			default:
+				return nil, fmt.Errorf("unknown overlay %q", name)
+			}
+		}
+	}
+	return overlays, nil
+}
+
+// chartRanges are the presets accepted by ?range=, in days back from today.
+var chartRanges = map[string]int{
+	"7d":  7,
+	"30d": 30,
+	"90d": 90,
+	"1y":  365,
+}
+
+const defaultChartRange = "90d"
+
+// parseChartRange resolves ?range= or explicit ?from=&to= dates (both
+// inclusive) to a [from, to) window in loc. A zero from means all history.
+func parseChartRange(r *http.Request, loc *time.Location) (from, to time.Time, err error) {
+	query := r.URL.Query()
+	to = models.StartOfDay(time.Now().In(loc)).AddDate(0, 0, 1)
+
+	if query.Get("from") != "" || query.Get("to") != "" {
+		from, end, err := parseDateBounds(r, loc)
+		if err != nil {
+			return from, to, err
+		}
+		if !end.IsZero() {
+			to = end
+		}
+		if from.IsZero() {
+			from = to.AddDate(0, 0, -chartRanges[defaultChartRange])
+		}
+		if !from.Before(to) {
+			return from, to, errors.New("from must not be after to")
+		}
+		return from, to, nil
+	}
+
+	name := query.Get("range")
+	if name == "" {
+		name = defaultChartRange
+	}
+	if name == "all" {
+		return time.Time{}, to, nil
+	}
+	days, ok := chartRanges[name]
+	if !ok {
+		return from, to, fmt.Errorf("unknown range %q", name)
+	}
+	return to.AddDate(0, 0, -days), to, nil
+}
+
+// chartBucket is the spread of readings behind one chart point.
+type chartBucket struct {
+	Start string  `json:"start"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+	Count int     `json:"count"`
+}
+
+// bucketLabel formats a bucket's start for the x axis. Years are only shown
+// when the chart spans more than one.
+func bucketLabel(start time.Time, bucket string, multiYear bool) string {
+	switch {
+	case bucket == models.BucketMonth:
+		return start.Format("Jan 2006")
+	case multiYear:
+		return start.Format("Jan 02, 2006")
+	}
+	return start.Format("Jan 02")
+}
+
 func (h *ChartHandler) GetWeightChartData(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r)
 	if userID == 0 {
@@ -26,52 +157,205 @@ func (h *ChartHandler) GetWeightChartData(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	weights, err := h.weightRepo.GetChartData(userID, 90)
+	overlays, err := parseOverlays(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = models.BucketDay
+	}
+	if !models.ValidBucket(bucket) {
+		http.Error(w, fmt.Sprintf("unknown bucket %q", bucket), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.settingsRepo.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
+	loc := settings.Location()
+	unit := settings.Unit
+
+	// Ranges are counted in the user's own calendar
+	from, to, err := parseChartRange(r, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	readings, err := h.weightRepo.GetRange(userID, from, to)
 	if err != nil {
 		http.Error(w, "Failed to fetch weight data", http.StatusInternalServerError)
 		return
 	}
+	daily := models.AggregateDaily(readings, settings.DailyAggregation, loc)
+	buckets := models.BucketWeights(readings, bucket, loc)
+
+	// Smoothed series are computed per day; each bucket shows its last day
+	lastDay := make([]int, len(buckets))
+	for i, j := 0, 0; i < len(daily); i++ {
+		for !buckets[j].End.After(daily[i].RecordedAt) {
+			j++
+		}
+		lastDay[j] = i
+	}
+
+	value := func(kg float64) *float64 {
+		v := models.FromKg(kg, unit)
+		return &v
+	}
+
+	multiYear := len(buckets) > 0 && buckets[0].Start.Year() != to.AddDate(0, 0, -1).Year()
+	labels := []string{}
+	bucketData := []chartBucket{}
+	for _, b := range buckets {
+		labels = append(labels, bucketLabel(b.Start, bucket, multiYear))
+		bucketData = append(bucketData, chartBucket{
+			Start: b.Start.Format("2006-01-02"),
+			Min:   models.FromKg(b.MinKg, unit),
+			Max:   models.FromKg(b.MaxKg, unit),
+			Mean:  models.FromKg(b.MeanKg, unit),
+			Count: b.Count,
+		})
+	}
+
+	// The projection runs past today, so it needs its own future labels
+	var trend *models.Trend
+	var future []time.Time
+	if overlays[overlayProjection] {
+		trendFrom := to.AddDate(0, 0, -goalTrendDays)
+		var recent []models.Weight
+		for _, weight := range daily {
+			if !weight.RecordedAt.Before(trendFrom) {
+				recent = append(recent, weight)
+			}
+		}
+		if t, ok := models.FitTrend(recent); ok {
+			trend = t
+		}
+
+		if trend != nil && to.After(time.Now()) {
+			end := to.AddDate(0, 0, projectionDays)
+			start := models.NextBucket(models.BucketStart(to.AddDate(0, 0, -1), bucket), bucket)
+			for ; start.Before(end); start = models.NextBucket(start, bucket) {
+				future = append(future, start)
+				labels = append(labels, bucketLabel(start, bucket, multiYear))
+			}
+		}
+	}
+
+	weightData := chartDataset{
+		Label:           "Weight (" + unit + ")",
+		Data:            make([]*float64, len(labels)),
+		BorderColor:     "#3b82f6",
+		BackgroundColor: "rgba(59, 130, 246, 0.1)",
+		Fill:            true,
+		Tension:         0.4,
+		PointRadius:     3,
+	}
+	for i, b := range buckets {
+		if bucket == models.BucketDay {
+			weightData.Data[i] = value(daily[i].WeightKg)
+		} else {
+			weightData.Data[i] = value(b.MeanKg)
+		}
+	}
+	datasets := []chartDataset{weightData}
+
+	if overlays[overlayAverage] {
+		dataset := newOverlay(fmt.Sprintf("%d-day average", models.MovingAverageDays), "#8b5cf6", len(labels))
+		averages := models.MovingAverage(daily, models.MovingAverageDays, loc)
+		for i := range buckets {
+			dataset.Data[i] = value(averages[lastDay[i]])
+		}
+		datasets = append(datasets, dataset)
+	}
+
+	if overlays[overlayTrend] {
+		dataset := newOverlay("Trend", "#f97316", len(labels))
+		smoothed := models.SmoothedTrend(daily, models.TrendSmoothing, loc)
+		for i := range buckets {
+			dataset.Data[i] = value(smoothed[lastDay[i]])
+		}
+		datasets = append(datasets, dataset)
+	}
+
+	if overlays[overlayGoal] {
+		goal, err := h.goalRepo.GetActive(userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Failed to load goal", http.StatusInternalServerError)
+			return
+		}
+		if goal != nil {
+			dataset := newOverlay("Goal", "#10b981", len(labels))
+			dataset.BorderDash = []int{6, 6}
+			for i := range dataset.Data {
+				dataset.Data[i] = value(goal.TargetWeightKg)
+			}
+			datasets = append(datasets, dataset)
+		}
+	}
+
+	if trend != nil {
+		dataset := newOverlay("Projection", "#6b7280", len(labels))
+		dataset.BorderDash = []int{4, 4}
+		for i := range buckets {
+			day := daily[lastDay[i]].RecordedAt
+			if !day.Before(trend.Origin) {
+				dataset.Data[i] = value(trend.At(day))
+			}
+		}
+		for i, start := range future {
+			mid := start.Add(models.NextBucket(start, bucket).Sub(start) / 2)
+			dataset.Data[len(buckets)+i] = value(trend.At(mid))
+		}
+		datasets = append(datasets, dataset)
+	}
 
 	chartData := struct {
-		Labels   []string `json:"labels"`
-		Datasets []struct {
-			Label           string    `json:"label"`
-			Data            []float64 `json:"data"`
-			BorderColor     string    `json:"borderColor"`
-			BackgroundColor string    `json:"backgroundColor"`
-			Fill            bool      `json:"fill"`
-			Tension         float64   `json:"tension"`
-		} `json:"datasets"`
+		Unit     string         `json:"unit"`
+		Bucket   string         `json:"bucket"`
+		From     string         `json:"from,omitempty"`
+		To       string         `json:"to"`
+		Labels   []string       `json:"labels"`
+		Datasets []chartDataset `json:"datasets"`
+		Buckets  []chartBucket  `json:"buckets"`
 	}{
-		Labels:   []string{},
-		Datasets: []struct {
-			Label           string    `json:"label"`
-			Data            []float64 `json:"data"`
-			BorderColor     string    `json:"borderColor"`
-			BackgroundColor string    `json:"backgroundColor"`
-			Fill            bool      `json:"fill"`
-			Tension         float64   `json:"tension"`
-		}{
-			{
-				Label:           "Weight (kg)",
-				Data:            []float64{},
-				BorderColor:     "#3b82f6",
-				BackgroundColor: "rgba(59, 130, 246, 0.1)",
-				Fill:            true,
-				Tension:         0.4,
-			},
-		},
+		Unit:     unit,
+		Bucket:   bucket,
+		To:       to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Labels:   labels,
+		Datasets: datasets,
+		Buckets:  bucketData,
 	}
-
-	for _, weight := range weights {
-		chartData.Labels = append(chartData.Labels, weight.RecordedAt.Format("Jan 02"))
-		chartData.Datasets[0].Data = append(chartData.Datasets[0].Data, weight.WeightKg)
+	if !from.IsZero() {
+		chartData.From = from.Format("2006-01-02")
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(chartData)
 }
 
+// statExtreme is a high or low reading in the stats response.
+type statExtreme struct {
+	Weight float64 `json:"weight"`
+	Date   string  `json:"date"`
+}
+
+// statPeriod is the high and low of a year, month or all history.
+type statPeriod struct {
+	Period string      `json:"period"`
+	High   statExtreme `json:"high"`
+	Low    statExtreme `json:"low"`
+}
+
+// statsMonths is how many recent months get their own highs and lows.
+const statsMonths = 12
+
 func (h *ChartHandler) GetWeightStats(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r)
 	if userID == 0 {
@@ -79,73 +363,188 @@ func (h *ChartHandler) GetWeightStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	weights, err := h.weightRepo.GetRecent(userID, 1000) // Get more data for stats
+	settings, err := h.settingsRepo.Get(userID)
 	if err != nil {
-		http.Error(w, "Failed to fetch weight data", http.StatusInternalServerError)
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
 		return
 	}
+	loc := settings.Location()
+	unit := settings.Unit
+
+	// Windows are whole calendar days in the user's timezone, ending today
+	today := models.StartOfDay(time.Now().In(loc))
+	tomorrow := today.AddDate(0, 0, 1)
+	cutoff7Days := today.AddDate(0, 0, -6)
+	cutoff30Days := today.AddDate(0, 0, -29)
 
 	stats := struct {
-		CurrentWeight float64 `json:"current_weight"`
-		Change7Days   float64 `json:"change_7_days"`
-		Change30Days  float64 `json:"change_30_days"`
-		AverageWeight float64 `json:"average_weight"`
-		TotalEntries  int     `json:"total_entries"`
-		MinWeight     float64 `json:"min_weight"`
-		MaxWeight     float64 `json:"max_weight"`
+		Unit                 string       `json:"unit"`
+		CurrentWeight        float64      `json:"current_weight"`
+		Change7Days          float64      `json:"change_7_days"`
+		Change30Days         float64      `json:"change_30_days"`
+		AverageWeight        float64      `json:"average_weight"`
+		TotalEntries         int          `json:"total_entries"`
+		MinWeight            float64      `json:"min_weight"`
+		MaxWeight            float64      `json:"max_weight"`
+		RollingAverage7Days  *float64     `json:"rolling_average_7_days"`
+		RollingAverage30Days *float64     `json:"rolling_average_30_days"`
+		WeeklyRate           float64      `json:"weekly_rate"`
+		StdDev               float64      `json:"std_dev"`
+		Volatility           float64      `json:"volatility"`
+		LongestStreak        int          `json:"longest_streak"`
+		CurrentStreak        int          `json:"current_streak"`
+		DaysSinceLastEntry   *int         `json:"days_since_last_entry"`
+		AllTime              *statPeriod  `json:"all_time"`
+		Yearly               []statPeriod `json:"yearly"`
+		Monthly              []statPeriod `json:"monthly"`
+		Goal                 *goalStats   `json:"goal"`
 	}{
-		TotalEntries: len(weights),
+		Unit:    unit,
+		Yearly:  []statPeriod{},
+		Monthly: []statPeriod{},
 	}
 
-	if len(weights) > 0 {
-		stats.CurrentWeight = weights[0].WeightKg
-		stats.MinWeight = weights[0].WeightKg
-		stats.MaxWeight = weights[0].WeightKg
+	fail := func(err error) {
+		log.Printf("Failed to compute stats for user %d: %v", userID, err)
+		http.Error(w, "Failed to fetch weight data", http.StatusInternalServerError)
+	}
 
-		var totalWeight float64
-		var weight7DaysAgo, weight30DaysAgo float64
-		found7Days, found30Days := false, false
+	summary, err := h.weightRepo.Summarize(userID, time.Time{}, time.Time{}, settings.DailyAggregation, loc)
+	if err != nil {
+		fail(err)
+		return
+	}
+	stats.TotalEntries = summary.Readings
 
-		for _, weight := range weights {
-			totalWeight += weight.WeightKg
+	if summary.Readings > 0 {
+		// Latest day against the last day logged 7 and 30 days ago or earlier
+		current, err := h.weightRepo.LatestDayBefore(userID, tomorrow, settings.DailyAggregation, loc)
+		if err != nil {
+			fail(err)
+			return
+		}
+		stats.CurrentWeight = models.FromKg(current.WeightKg, unit)
 
-			if weight.WeightKg < stats.MinWeight {
-				stats.MinWeight = weight.WeightKg
+		for _, change := range []struct {
+			cutoff time.Time
+			field  *float64
+		}{
+			{cutoff7Days, &stats.Change7Days},
+			{cutoff30Days, &stats.Change30Days},
+		} {
+			past, err := h.weightRepo.LatestDayBefore(userID, change.cutoff, settings.DailyAggregation, loc)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
 			}
-			if weight.WeightKg > stats.MaxWeight {
-				stats.MaxWeight = weight.WeightKg
+			if err != nil {
+				fail(err)
+				return
 			}
+			*change.field = models.FromKg(current.WeightKg-past.WeightKg, unit)
+		}
+
+		stats.AverageWeight = models.FromKg(summary.MeanKg, unit)
+		stats.StdDev = models.FromKg(summary.StdDevKg, unit)
+		stats.WeeklyRate = models.FromKg(summary.SlopeKgPerDay*7, unit)
 
-			// Find weight 7 days ago
-			if !found7Days {
-				daysDiff := time.Since(weight.RecordedAt).Hours() / 24
-				if daysDiff >= 7 {
-					weight7DaysAgo = weight.WeightKg
-					found7Days = true
-				}
+		for _, rolling := range []struct {
+			from  time.Time
+			field **float64
+		}{
+			{cutoff7Days, &stats.RollingAverage7Days},
+			{cutoff30Days, &stats.RollingAverage30Days},
+		} {
+			window, err := h.weightRepo.Summarize(userID, rolling.from, tomorrow, settings.DailyAggregation, loc)
+			if err != nil {
+				fail(err)
+				return
+			}
+			if window.Days > 0 {
+				average := models.FromKg(window.MeanKg, unit)
+				*rolling.field = &average
 			}
+		}
+
+		volatility, _, err := h.weightRepo.Volatility(userID, cutoff30Days, tomorrow, settings.DailyAggregation, loc)
+		if err != nil {
+			fail(err)
+			return
+		}
+		stats.Volatility = models.FromKg(volatility, unit)
 
-			// Find weight 30 days ago
-			if !found30Days {
-				daysDiff := time.Since(weight.RecordedAt).Hours() / 24
-				if daysDiff >= 30 {
-					weight30DaysAgo = weight.WeightKg
-					found30Days = true
-				}
+		days, err := h.weightRepo.LoggedDays(userID, loc)
+		if err != nil {
+			fail(err)
+			return
+		}
+		stats.LongestStreak, stats.CurrentStreak = models.LoggingStreaks(days, today)
+		since := int(math.Round(today.Sub(days[len(days)-1]).Hours() / 24))
+		stats.DaysSinceLastEntry = &since
+
+		// Highs and lows for all history, each year and the recent months
+		first := days[0]
+		allTime := []models.Period{{Label: "all", Start: first, End: tomorrow}}
+
+		var years []models.Period
+		for year := today.Year(); year >= first.Year(); year-- {
+			start := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+			years = append(years, models.Period{Label: start.Format("2006"), Start: start, End: start.AddDate(1, 0, 0)})
+		}
+
+		var months []models.Period
+		month := models.BucketStart(today, models.BucketMonth)
+		for i := 0; i < statsMonths && !month.AddDate(0, 1, 0).Before(first); i++ {
+			months = append(months, models.Period{Label: month.Format("2006-01"), Start: month, End: month.AddDate(0, 1, 0)})
+			month = month.AddDate(0, -1, 0)
+		}
+
+		toStats := func(extremes []models.PeriodExtremes) []statPeriod {
+			periods := []statPeriod{}
+			for _, e := range extremes {
+				periods = append(periods, statPeriod{
+					Period: e.Label,
+					High:   statExtreme{models.FromKg(e.High.WeightKg, unit), e.High.RecordedAt.In(loc).Format("2006-01-02")},
+					Low:    statExtreme{models.FromKg(e.Low.WeightKg, unit), e.Low.RecordedAt.In(loc).Format("2006-01-02")},
+				})
 			}
+			return periods
 		}
 
-		stats.AverageWeight = totalWeight / float64(len(weights))
+		allTimeExtremes, err := h.weightRepo.Extremes(userID, allTime, settings.DailyAggregation, loc)
+		if err != nil {
+			fail(err)
+			return
+		}
+		if len(allTimeExtremes) > 0 {
+			stats.AllTime = &toStats(allTimeExtremes)[0]
+			stats.MinWeight = stats.AllTime.Low.Weight
+			stats.MaxWeight = stats.AllTime.High.Weight
+		}
 
-		if found7Days {
-			stats.Change7Days = stats.CurrentWeight - weight7DaysAgo
+		yearly, err := h.weightRepo.Extremes(userID, years, settings.DailyAggregation, loc)
+		if err != nil {
+			fail(err)
+			return
 		}
+		stats.Yearly = toStats(yearly)
 
-		if found30Days {
-			stats.Change30Days = stats.CurrentWeight - weight30DaysAgo
+		monthly, err := h.weightRepo.Extremes(userID, months, settings.DailyAggregation, loc)
+		if err != nil {
+			fail(err)
+			return
 		}
+		stats.Monthly = toStats(monthly)
+	}
+
+	goal, err := loadGoalView(h.weightRepo, h.goalRepo, settings, userID)
+	if err != nil {
+		http.Error(w, "Failed to load goal", http.StatusInternalServerError)
+		return
+	}
+	if goal != nil {
+		stats.Goal = goal.Stats()
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
-}
\ No newline at end of file
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
+)
+
+type ExportHandler struct {
+	weightRepo   *models.WeightRepository
+	settingsRepo *models.SettingsRepository
+}
+
+func NewExportHandler(db *sql.DB) *ExportHandler {
+	return &ExportHandler{
+		weightRepo:   models.NewWeightRepository(db),
+		settingsRepo: models.NewSettingsRepository(db),
+	}
+}
+
+// parseDateBounds reads optional ?from= and ?to= dates (both inclusive) as a
+// [from, to) window in loc. A missing date leaves that end open.
+func parseDateBounds(r *http.Request, loc *time.Location) (from, to time.Time, err error) {
+	query := r.URL.Query()
+
+	if v := query.Get("from"); v != "" {
+		from, err = time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from date %q", v)
+		}
+	}
+
+	if v := query.Get("to"); v != "" {
+		day, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to date %q", v)
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, fmt.Errorf("from must not be after to")
+	}
+	return from, to, nil
+}
+
+// WeightsCSV downloads the user's history as CSV for the web UI.
+func (h *ExportHandler) WeightsCSV(w http.ResponseWriter, r *http.Request) {
+	h.streamCSV(w, r, func(status int, message string) {
+		http.Error(w, message, status)
+	})
+}
+
+// WeightsCSVAPI is WeightsCSV for API clients, with JSON errors.
+func (h *ExportHandler) WeightsCSVAPI(w http.ResponseWriter, r *http.Request) {
+	h.streamCSV(w, r, func(status int, message string) {
+		writeJSONError(w, status, message)
+	})
+}
+
+// streamCSV writes every entry in the requested range, oldest first, straight
+// from the database cursor. Times are in the user's timezone and weights in
+// both their unit and kg.
+func (h *ExportHandler) streamCSV(w http.ResponseWriter, r *http.Request, fail func(status int, message string)) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		fail(http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	settings, err := h.settingsRepo.Get(userID)
+	if err != nil {
+		fail(http.StatusInternalServerError, "failed to load settings")
+		return
+	}
+	loc := settings.Location()
+	unit := settings.Unit
+
+	from, to, err := parseDateBounds(r, loc)
+	if err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filename := "weights-" + time.Now().In(loc).Format("2006-01-02") + ".csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"date", "time", "weight (" + unit + ")", "weight_kg", "notes"})
+
+	// Headers are sent with the first rows, so later errors can only be logged
+	err = h.weightRepo.Each(userID, from, to, func(weight models.Weight) error {
+		recordedAt := weight.RecordedAt.In(loc)
+		return out.Write([]string{
+			recordedAt.Format("2006-01-02"),
+			recordedAt.Format("15:04"),
+			strconv.FormatFloat(models.FromKg(weight.WeightKg, unit), 'f', -1, 64),
+			strconv.FormatFloat(math.Round(weight.WeightKg*1000)/1000, 'f', -1, 64), // to the gram
+			spreadsheetSafe(weight.Notes),
+		})
+	})
+	out.Flush()
+
+	if err == nil {
+		err = out.Error()
+	}
+	if err != nil {
+		log.Printf("Failed to export weights for user %d: %v", userID, err)
+	}
+}
+
+// spreadsheetSafe quotes free text that a spreadsheet would otherwise run as
+// a formula when the file is opened. The leading apostrophe is hidden by the
+// spreadsheet but kept in the cell.
+func spreadsheetSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
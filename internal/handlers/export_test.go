@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
+)
+
+func TestWeightsCSVEscapesFormulas(t *testing.T) {
+	db := newTestDB(t)
+	alice := mustCreateUser(t, db, "alice")
+
+	notes := []string{
+		"after run",
+		"=HYPERLINK(\"http://example.com\")",
+		"+1 kg",
+		"-2 kg",
+		"@SUM(A1)",
+		"\tindented",
+		"\rreturn",
+		"a = b",
+		"",
+	}
+	weights := models.NewWeightRepository(db)
+	start := time.Date(2023, 1, 1, 8, 0, 0, 0, time.UTC)
+	for i, note := range notes {
+		err := weights.Create(&models.Weight{UserID: alice.ID, WeightKg: 80, RecordedAt: start.AddDate(0, 0, i), Notes: note})
+		if err != nil {
+			t.Fatalf("create weight: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/export/weights.csv", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, alice.ID))
+	rec := httptest.NewRecorder()
+	NewExportHandler(db).WeightsCSV(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	if len(records) != len(notes)+1 {
+		t.Fatalf("got %d records, want %d", len(records), len(notes)+1)
+	}
+
+	want := []string{
+		"after run",
+		"'=HYPERLINK(\"http://example.com\")",
+		"'+1 kg",
+		"'-2 kg",
+		"'@SUM(A1)",
+		"'\tindented",
+		"'\rreturn",
+		"a = b",
+		"",
+	}
+	for i, record := range records[1:] {
+		if record[0] != start.AddDate(0, 0, i).Format("2006-01-02") || record[3] != "80" {
+			t.Errorf("row %d = %q", i+1, record)
+		}
+		if record[4] != want[i] {
+			t.Errorf("row %d notes = %q, want %q", i+1, record[4], want[i])
+		}
+	}
+}
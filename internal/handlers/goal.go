@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
+)
+
+// goalTrendDays is how much recent history the projected finish is based on.
+const goalTrendDays = 30
+
+type GoalHandler struct {
+	weightRepo   *models.WeightRepository
+	goalRepo     *models.GoalRepository
+	settingsRepo *models.SettingsRepository
+	tmpl         *template.Template
+}
+
+func NewGoalHandler(db *sql.DB) *GoalHandler {
+	return &GoalHandler{
+		weightRepo:   models.NewWeightRepository(db),
+		goalRepo:     models.NewGoalRepository(db),
+		settingsRepo: models.NewSettingsRepository(db),
+		tmpl:         newPageTemplate("templates/goals.html"),
+	}
+}
+
+// goalView is a goal with its progress, prepared for display in the user's
+// unit and timezone.
+type goalView struct {
+	Goal     models.Goal
+	Progress models.GoalProgress
+	Unit     string
+	Location *time.Location
+}
+
+// loadGoalView returns the user's active goal with its progress, or nil if
+// no goal is set or nothing has been logged yet.
+func loadGoalView(weightRepo *models.WeightRepository, goalRepo *models.GoalRepository, settings *models.Settings, userID int) (*goalView, error) {
+	goal, err := goalRepo.GetActive(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Progress is measured from the latest day, like the current weight in
+	// the stats
+	loc := settings.Location()
+	now := time.Now().In(loc)
+	to := models.StartOfDay(now).AddDate(0, 0, 1)
+	latest, err := weightRepo.LatestDayBefore(userID, to, settings.DailyAggregation, loc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Project from the trend of recent daily values
+	recent, err := weightRepo.GetRange(userID, to.AddDate(0, 0, -goalTrendDays), to)
+	if err != nil {
+		return nil, err
+	}
+	trend, _ := models.FitTrend(models.AggregateDaily(recent, settings.DailyAggregation, loc))
+
+	return &goalView{
+		Goal:     *goal,
+		Progress: goal.Progress(latest.WeightKg, trend, now),
+		Unit:     settings.Unit,
+		Location: loc,
+	}, nil
+}
+
+func (g *goalView) Start() string {
+	return models.FormatWeight(g.Goal.StartWeightKg, g.Unit)
+}
+
+func (g *goalView) Target() string {
+	return models.FormatWeight(g.Goal.TargetWeightKg, g.Unit)
+}
+
+func (g *goalView) Current() string {
+	return models.FormatWeight(g.Progress.CurrentKg, g.Unit)
+}
+
+func (g *goalView) ProgressPercent() int {
+	return int(math.Round(g.Progress.ProgressPercent))
+}
+
+// Remaining reads e.g. "4.2 kg to lose".
+func (g *goalView) Remaining() string {
+	direction := "to gain"
+	if g.Progress.RemainingKg < 0 {
+		direction = "to lose"
+	}
+	return formatDelta(math.Abs(g.Progress.RemainingKg), g.Unit) + " " + direction
+}
+
+func (g *goalView) TargetDate() string {
+	if g.Goal.TargetDate == nil {
+		return ""
+	}
+	return g.Goal.TargetDate.In(g.Location).Format("Jan 02, 2006")
+}
+
+func (g *goalView) RequiredRate() string {
+	if g.Progress.RequiredKgPerWeek == nil {
+		return ""
+	}
+	return formatRate(*g.Progress.RequiredKgPerWeek, g.Unit)
+}
+
+func (g *goalView) TrendRate() string {
+	if g.Progress.TrendKgPerWeek == nil {
+		return ""
+	}
+	return formatRate(*g.Progress.TrendKgPerWeek, g.Unit)
+}
+
+func (g *goalView) ProjectedDate() string {
+	if g.Progress.ProjectedDate == nil {
+		return ""
+	}
+	return g.Progress.ProjectedDate.In(g.Location).Format("Jan 02, 2006")
+}
+
+// goalStats is the goal section of the stats endpoint, in the user's unit.
+type goalStats struct {
+	StartWeight         float64  `json:"start_weight"`
+	TargetWeight        float64  `json:"target_weight"`
+	TargetDate          *string  `json:"target_date"`
+	CurrentWeight       float64  `json:"current_weight"`
+	ProgressPercent     float64  `json:"progress_percent"`
+	Remaining           float64  `json:"remaining"`
+	RequiredRatePerWeek *float64 `json:"required_rate_per_week"`
+	TrendRatePerWeek    *float64 `json:"trend_rate_per_week"`
+	ProjectedDate       *string  `json:"projected_date"`
+	Achieved            bool     `json:"achieved"`
+}
+
+func (g *goalView) Stats() *goalStats {
+	stats := &goalStats{
+		StartWeight:     models.FromKg(g.Goal.StartWeightKg, g.Unit),
+		TargetWeight:    models.FromKg(g.Goal.TargetWeightKg, g.Unit),
+		CurrentWeight:   models.FromKg(g.Progress.CurrentKg, g.Unit),
+		ProgressPercent: math.Round(g.Progress.ProgressPercent*10) / 10,
+		Remaining:       models.FromKg(g.Progress.RemainingKg, g.Unit),
+		Achieved:        g.Progress.Achieved,
+	}
+
+	if g.Goal.TargetDate != nil {
+		date := g.Goal.TargetDate.In(g.Location).Format("2006-01-02")
+		stats.TargetDate = &date
+	}
+	if g.Progress.RequiredKgPerWeek != nil {
+		rate := models.FromKg(*g.Progress.RequiredKgPerWeek, g.Unit)
+		stats.RequiredRatePerWeek = &rate
+	}
+	if g.Progress.TrendKgPerWeek != nil {
+		rate := models.FromKg(*g.Progress.TrendKgPerWeek, g.Unit)
+		stats.TrendRatePerWeek = &rate
+	}
+	if g.Progress.ProjectedDate != nil {
+		date := g.Progress.ProjectedDate.In(g.Location).Format("2006-01-02")
+		stats.ProjectedDate = &date
+	}
+
+	return stats
+}
+
+// formatDelta renders a weight difference in unit. Stones are shown as
+// pounds, which reads better for small amounts.
+func formatDelta(kg float64, unit string) string {
+	if unit == models.UnitSt {
+		unit = models.UnitLb
+	}
+	return strconv.FormatFloat(models.FromKg(kg, unit), 'f', 1, 64) + " " + unit
+}
+
+// formatRate renders a signed weekly rate, e.g. "-0.5 kg/week".
+func formatRate(kgPerWeek float64, unit string) string {
+	sign := "+"
+	if kgPerWeek < 0 {
+		sign = "-"
+	}
+	return sign + formatDelta(math.Abs(kgPerWeek), unit) + "/week"
+}
+
+// goalHistoryRow is a past or current goal for the history table.
+type goalHistoryRow struct {
+	models.Goal
+	Unit     string
+	Location *time.Location
+}
+
+func (g goalHistoryRow) Start() string {
+	return models.FormatWeight(g.StartWeightKg, g.Unit)
+}
+
+func (g goalHistoryRow) Target() string {
+	return models.FormatWeight(g.TargetWeightKg, g.Unit)
+}
+
+func (g goalHistoryRow) Set() string {
+	return g.CreatedAt.In(g.Location).Format("Jan 02, 2006")
+}
+
+func (g goalHistoryRow) Due() string {
+	if g.TargetDate == nil {
+		return ""
+	}
+	return g.TargetDate.In(g.Location).Format("Jan 02, 2006")
+}
+
+func (g goalHistoryRow) Closed() string {
+	if g.ClosedAt == nil {
+		return ""
+	}
+	return g.ClosedAt.In(g.Location).Format("Jan 02, 2006")
+}
+
+// Goals shows the active goal and goal history (GET) or sets a new goal
+// (POST). The previous goal is kept in the history.
+func (h *GoalHandler) Goals(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+
+	settings, err := h.settingsRepo.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]interface{}{}
+
+	switch r.Method {
+	case http.MethodGet:
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form data", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.createGoal(r, userID, settings); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			data["Error"] = err.Error()
+			break
+		}
+
+		http.Redirect(w, r, "/goals", http.StatusSeeOther)
+		return
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.render(w, r, userID, settings, data)
+}
+
+// CloseGoal ends the active goal without setting a new one.
+func (h *GoalHandler) CloseGoal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	if err := h.goalRepo.CloseActive(userID); err != nil {
+		log.Printf("Failed to close goal for user %d: %v", userID, err)
+		http.Error(w, "Failed to close goal", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/goals", http.StatusSeeOther)
+}
+
+func (h *GoalHandler) createGoal(r *http.Request, userID int, settings *models.Settings) error {
+	target, err := parseFormWeight(r, settings.Unit)
+	if err != nil {
+		return err
+	}
+
+	// Progress is measured from the latest day's value
+	loc := settings.Location()
+	tomorrow := models.StartOfDay(time.Now().In(loc)).AddDate(0, 0, 1)
+	latest, err := h.weightRepo.LatestDayBefore(userID, tomorrow, settings.DailyAggregation, loc)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("Log your current weight before setting a goal")
+	}
+	if err != nil {
+		return errors.New("Failed to load your latest weight")
+	}
+
+	goal := &models.Goal{
+		UserID:         userID,
+		StartWeightKg:  latest.WeightKg,
+		TargetWeightKg: target,
+	}
+
+	if v := r.FormValue("target_date"); v != "" {
+		date, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			return errors.New("Invalid target date")
+		}
+		if !date.After(models.StartOfDay(time.Now().In(loc))) {
+			return errors.New("Target date must be in the future")
+		}
+		goal.TargetDate = &date
+	}
+
+	if err := h.goalRepo.Create(goal); err != nil {
+		log.Printf("Failed to create goal for user %d: %v", userID, err)
+		return errors.New("Failed to save goal")
+	}
+	return nil
+}
+
+func (h *GoalHandler) render(w http.ResponseWriter, r *http.Request, userID int, settings *models.Settings, data map[string]interface{}) {
+	goal, err := loadGoalView(h.weightRepo, h.goalRepo, settings, userID)
+	if err != nil {
+		http.Error(w, "Failed to load goal", http.StatusInternalServerError)
+		return
+	}
+
+	goals, err := h.goalRepo.ListByUser(userID)
+	if err != nil {
+		http.Error(w, "Failed to load goals", http.StatusInternalServerError)
+		return
+	}
+
+	history := make([]goalHistoryRow, 0, len(goals))
+	for _, g := range goals {
+		history = append(history, goalHistoryRow{Goal: g, Unit: settings.Unit, Location: settings.Location()})
+	}
+
+	data["Title"] = "Goals"
+	data["CSRFToken"] = middleware.CSRFToken(r)
+	data["CSPNonce"] = middleware.CSPNonce(r)
+	data["Goal"] = goal
+	data["History"] = history
+	data["Unit"] = settings.Unit
+	h.tmpl.ExecuteTemplate(w, "base", data)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+	"weight-tracker/internal/models"
+)
+
+func TestGoalProgressUsesLatestDay(t *testing.T) {
+	db := newTestDB(t)
+	alice := mustCreateUser(t, db, "alice")
+	weights := models.NewWeightRepository(db)
+	goals := models.NewGoalRepository(db)
+
+	settings := models.DefaultSettings()
+	settings.EntryMode = models.EntryModeMultiple
+	settings.DailyAggregation = models.AggregateMean
+
+	today := models.StartOfDay(time.Now().UTC())
+	for _, w := range []models.Weight{
+		{UserID: alice.ID, WeightKg: 90, RecordedAt: today.AddDate(0, 0, -1).Add(8 * time.Hour)},
+		{UserID: alice.ID, WeightKg: 84, RecordedAt: today.Add(time.Minute)},
+		{UserID: alice.ID, WeightKg: 86, RecordedAt: today.Add(2 * time.Minute)},
+	} {
+		if err := weights.Create(&w); err != nil {
+			t.Fatalf("create weight: %v", err)
+		}
+	}
+	if err := goals.Create(&models.Goal{UserID: alice.ID, StartWeightKg: 90, TargetWeightKg: 80}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+
+	view, err := loadGoalView(weights, goals, settings, alice.ID)
+	if err != nil {
+		t.Fatalf("load goal: %v", err)
+	}
+	// Today's mean, not its last reading
+	if view == nil || view.Progress.CurrentKg != 85 || view.Progress.ProgressPercent != 50 {
+		t.Fatalf("progress = %+v, want 85 kg and 50%%", view)
+	}
+}
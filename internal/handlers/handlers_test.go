@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"weight-tracker/internal/config"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
+)
+
+// Handlers load templates and migrations relative to the repository root.
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	database, err := config.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database.GetDB()
+}
+
+func mustCreateUser(t *testing.T, db *sql.DB, username string) *models.User {
+	t.Helper()
+
+	user, err := models.NewUserRepository(db).Create(username, "password123")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// testLoginPolicy throttles hard enough that a retry straight after a
+// failure is always refused.
+var testLoginPolicy = models.LoginPolicy{
+	MaxFailures:      3,
+	MaxFailuresPerIP: 5,
+	Window:           10 * time.Minute,
+	Backoff:          time.Minute,
+	Lockout:          15 * time.Minute,
+}
+
+// newTestServer wires the account pages and the weights API the way
+// cmd/server does, including authentication and CSRF checks.
+func newTestServer(db *sql.DB) http.Handler {
+	account := NewAccountHandler(db, testLoginPolicy, middleware.Cookies{})
+	weightAPI := NewWeightAPIHandler(db)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/account/sessions", account.Sessions)
+	mux.HandleFunc("/account/tokens", account.Tokens)
+	mux.HandleFunc("/account/password", account.ChangePassword)
+	mux.HandleFunc("/account/delete", account.DeleteAccount)
+	mux.HandleFunc("/account/two-factor", account.TwoFactor)
+	mux.HandleFunc("GET /account/data/export", account.DataExport)
+	mux.HandleFunc("/api/v1/weights", weightAPI.Weights)
+	mux.HandleFunc("/api/v1/weights/{id}", weightAPI.Weight)
+	mux.HandleFunc("GET /api/v1/account/export", account.ExportAPI)
+	mux.HandleFunc("DELETE /api/v1/account", account.DeleteAccountAPI)
+
+	routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+			middleware.RequireAPIAuth(mux).ServeHTTP(w, r)
+			return
+		}
+		middleware.RequireAuth(mux).ServeHTTP(w, r)
+	})
+
+	auth := middleware.AuthMiddleware(models.NewUserRepository(db), models.NewSessionRepository(db), models.NewAPITokenRepository(db), middleware.Cookies{})
+	return middleware.CSRF(middleware.Cookies{})(auth(routed))
+}
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+	"weight-tracker/internal/importer"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
+)
+
+const (
+	// maxImportBytes caps the size of a generic CSV file, which is carried
+	// through the preview form.
+	maxImportBytes = 5 << 20
+	// maxUploadBytes caps an upload request. App exports, Apple Health's in
+	// particular, are much larger than the readings they contain.
+	maxUploadBytes = 100 << 20
+	// uploadTimeout is how long an upload request may take to arrive and be
+	// answered, in place of the server's timeouts for ordinary requests.
+	uploadTimeout = 5 * time.Minute
+	// importPreviewRows is how many rows the preview shows.
+	importPreviewRows = 20
+	// maxImportErrors is how many failed rows are listed.
+	maxImportErrors = 100
+)
+
+type ImportHandler struct {
+	weightRepo   *models.WeightRepository
+	settingsRepo *models.SettingsRepository
+	tmpl         *template.Template
+}
+
+func NewImportHandler(db *sql.DB) *ImportHandler {
+	return &ImportHandler{
+		weightRepo:   models.NewWeightRepository(db),
+		settingsRepo: models.NewSettingsRepository(db),
+		tmpl:         newPageTemplate("templates/import.html"),
+	}
+}
+
+// importRow is a parsed row for the preview and error report.
+type importRow struct {
+	importer.Row
+	Unit     string
+	Location *time.Location
+}
+
+func (r importRow) Date() string {
+	if r.Weight.RecordedAt.IsZero() {
+		return ""
+	}
+	return r.Weight.RecordedAt.In(r.Location).Format("Jan 02, 2006 15:04")
+}
+
+func (r importRow) Value() string {
+	if r.Weight.WeightKg == 0 {
+		return ""
+	}
+	return models.FormatWeight(r.Weight.WeightKg, r.Unit)
+}
+
+// Import runs the import: upload a file (GET shows the form), check what was
+// found in a preview, then commit the rows in one go. Generic CSV files are
+// carried through the preview form so their column mapping can be changed;
+// app exports are parsed once and their rows carried instead. Nothing is
+// kept server-side between steps.
+func (h *ImportHandler) Import(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{
+		"Title":       "Import",
+		"CSRFToken":   middleware.CSRFToken(r),
+		"CSPNonce":    middleware.CSPNonce(r),
+		"Step":        "upload",
+		"DateFormats": importer.DateFormats,
+		"Adapters":    importer.Adapters,
+		"Duplicates":  models.DuplicateSkip,
+	}
+	render := func(status int) {
+		w.WriteHeader(status)
+		h.tmpl.ExecuteTemplate(w, "base", data)
+	}
+	fail := func(status int, message string) {
+		data["Error"] = message
+		render(status)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		render(http.StatusOK)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	allowSlowUpload(w)
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		fail(http.StatusBadRequest, fmt.Sprintf("The upload failed or is larger than %d MB", maxUploadBytes>>20))
+		return
+	}
+
+	userID := middleware.GetUserID(r)
+	settings, err := h.settingsRepo.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
+	loc := settings.Location()
+
+	var rows []importer.Row
+	var content []byte
+	var adapter *importer.Adapter
+	duplicates := models.DuplicateSkip
+
+	switch uploads := r.MultipartForm.File["file"]; {
+	case len(uploads) > 0:
+		adapter, content, rows, err = readUploads(uploads, r.FormValue("format"), loc)
+		if err != nil {
+			fail(http.StatusBadRequest, err.Error())
+			return
+		}
+
+	case r.FormValue("rows") != "":
+		// App export rows from the preview
+		a, ok := importer.FindAdapter(r.FormValue("adapter"))
+		if !ok {
+			fail(http.StatusBadRequest, "Unknown import format")
+			return
+		}
+		adapter = &a
+		if rows, err = decodeImportRows(r.FormValue("rows")); err != nil {
+			fail(http.StatusBadRequest, "Choose a file to import")
+			return
+		}
+		duplicates = r.FormValue("duplicates")
+
+	default:
+		// Generic CSV from the preview
+		content, err = base64.StdEncoding.DecodeString(r.FormValue("data"))
+		if err != nil || len(content) == 0 {
+			fail(http.StatusBadRequest, "Choose a file to import")
+			return
+		}
+		duplicates = r.FormValue("duplicates")
+	}
+
+	data["Step"] = "preview"
+	data["Duplicates"] = duplicates
+
+	if adapter != nil {
+		encoded, err := encodeImportRows(rows)
+		if err != nil {
+			http.Error(w, "Failed to prepare import", http.StatusInternalServerError)
+			return
+		}
+		data["Adapter"] = adapter
+		data["Rows"] = encoded
+	} else {
+		file, err := importer.Read(content)
+		if err != nil {
+			data["Step"] = "upload"
+			fail(http.StatusBadRequest, "Couldn't read the file: "+err.Error())
+			return
+		}
+
+		// A fresh upload starts from the detected mapping
+		mapping := importer.Detect(file)
+		if r.MultipartForm.File["file"] == nil {
+			mapping = mappingFromForm(r)
+		}
+
+		data["Data"] = base64.StdEncoding.EncodeToString(content)
+		data["Columns"] = file.Columns(mapping.HasHeader)
+		data["Mapping"] = mapping
+
+		if err := mapping.Validate(file); err != nil {
+			fail(http.StatusUnprocessableEntity, "Check the column mapping: "+err.Error())
+			return
+		}
+		rows = file.Rows(mapping, loc)
+	}
+
+	if !models.ValidDuplicateMode(duplicates) {
+		fail(http.StatusUnprocessableEntity, "Choose how to handle days that already have an entry")
+		return
+	}
+
+	var valid []models.Weight
+	var failed []importRow
+	for _, row := range rows {
+		if row.Error != "" {
+			failed = append(failed, importRow{Row: row, Unit: settings.Unit, Location: loc})
+			continue
+		}
+		weight := row.Weight
+		weight.UserID = userID
+		valid = append(valid, weight)
+	}
+
+	data["Total"] = len(rows)
+	data["Valid"] = len(valid)
+	data["FailedCount"] = len(failed)
+	if len(failed) > maxImportErrors {
+		failed = failed[:maxImportErrors]
+	}
+	data["Failed"] = failed
+
+	if r.FormValue("action") != "import" {
+		preview := make([]importRow, 0, importPreviewRows)
+		for i := 0; i < len(rows) && i < importPreviewRows; i++ {
+			preview = append(preview, importRow{Row: rows[i], Unit: settings.Unit, Location: loc})
+		}
+		data["Preview"] = preview
+		render(http.StatusOK)
+		return
+	}
+
+	if len(valid) == 0 {
+		fail(http.StatusUnprocessableEntity, "There are no valid rows to import")
+		return
+	}
+
+	result, err := h.weightRepo.Import(userID, valid, duplicates, loc)
+	if err != nil {
+		log.Printf("Failed to import weights for user %d: %v", userID, err)
+		fail(http.StatusInternalServerError, "The import failed and nothing was saved")
+		return
+	}
+
+	data["Step"] = "done"
+	data["Result"] = result
+	render(http.StatusOK)
+}
+
+// readUploads reads the uploaded files. App exports are parsed by their
+// adapter, and several can be imported at once (Fitbit splits its export by
+// month). Anything else is a generic CSV file, whose content is returned for
+// column mapping.
+func readUploads(uploads []*multipart.FileHeader, format string, loc *time.Location) (*importer.Adapter, []byte, []importer.Row, error) {
+	var adapter *importer.Adapter
+	var rows []importer.Row
+
+	for _, upload := range uploads {
+		a, content, fileRows, err := readUpload(upload, format, len(uploads), loc)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if a == nil {
+			return nil, content, nil, nil
+		}
+
+		if adapter != nil && adapter.Key != a.Key {
+			return nil, nil, nil, errors.New("All files have to come from the same app")
+		}
+		adapter = a
+		rows = append(rows, fileRows...)
+	}
+
+	return adapter, nil, rows, nil
+}
+
+// readUpload reads one of count uploaded files, returning either the rows
+// its adapter parsed or, for a generic CSV file, its content.
+func readUpload(upload *multipart.FileHeader, format string, count int, loc *time.Location) (*importer.Adapter, []byte, []importer.Row, error) {
+	file, err := upload.Open()
+	if err != nil {
+		return nil, nil, nil, errors.New("The upload failed")
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	head, _ := reader.Peek(512)
+
+	var a importer.Adapter
+	var ok bool
+	switch format {
+	case "", "auto":
+		a, ok = importer.DetectAdapter(upload.Filename, head)
+	case "csv":
+	default:
+		if a, ok = importer.FindAdapter(format); !ok {
+			return nil, nil, nil, errors.New("Unknown import format")
+		}
+	}
+
+	if !ok {
+		if bytes.Contains(head, []byte(models.ArchiveFormat)) {
+			return nil, nil, nil, errors.New("This is an account archive. Restore it from the Your Data page instead")
+		}
+		if count > 1 {
+			return nil, nil, nil, errors.New("CSV files have to be imported one at a time")
+		}
+		content, err := io.ReadAll(io.LimitReader(reader, maxImportBytes+1))
+		if err != nil {
+			return nil, nil, nil, errors.New("The upload failed")
+		}
+		if len(content) > maxImportBytes {
+			return nil, nil, nil, fmt.Errorf("CSV files must be at most %d MB", maxImportBytes>>20)
+		}
+		return nil, content, nil, nil
+	}
+
+	rows, err := a.Parse(reader, loc)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Couldn't read %s as a %s export: %v", upload.Filename, a.Label, err)
+	}
+	if count > 1 {
+		for i := range rows {
+			rows[i].Source = upload.Filename
+		}
+	}
+	return &a, nil, rows, nil
+}
+
+// allowSlowUpload extends the connection's deadlines for a request carrying
+// an upload. The server's timeouts suit ordinary requests, but would cut off
+// a large export sent over a slow link.
+func allowSlowUpload(w http.ResponseWriter) {
+	deadline := time.Now().Add(uploadTimeout)
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Failed to extend upload read deadline: %v", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Failed to extend upload write deadline: %v", err)
+	}
+}
+
+func encodeImportRows(rows []importer.Row) (string, error) {
+	encoded, err := json.Marshal(rows)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encoded), nil
+}
+
+// decodeImportRows reads rows carried through the preview form. They came
+// from the client, so they are validated again.
+func decodeImportRows(value string) ([]importer.Row, error) {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var rows []importer.Row
+	if err := json.Unmarshal(decoded, &rows); err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Validate()
+	}
+	return rows, nil
+}
+
+func mappingFromForm(r *http.Request) importer.Mapping {
+	column := func(name string) int {
+		n, err := strconv.Atoi(r.FormValue(name))
+		if err != nil {
+			return importer.NoColumn - 1 // Fails validation
+		}
+		return n
+	}
+
+	return importer.Mapping{
+		HasHeader:    r.FormValue("has_header") == "on",
+		DateColumn:   column("date_column"),
+		TimeColumn:   column("time_column"),
+		WeightColumn: column("weight_column"),
+		NotesColumn:  column("notes_column"),
+		DateFormat:   r.FormValue("date_format"),
+		Unit:         r.FormValue("unit"),
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// uploadFiles builds a multipart form with the given files, keyed by name,
+// and returns their headers the way Import sees them.
+func uploadFiles(t *testing.T, files map[string]string) []*multipart.FileHeader {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, content := range files {
+		fw, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatalf("create form file: %v", err)
+		}
+		fw.Write([]byte(content))
+	}
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatalf("parse form: %v", err)
+	}
+	return req.MultipartForm.File["file"]
+}
+
+func TestReadUploadsDetectsByContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		adapter string // Empty for generic CSV
+		rows    int
+		err     string
+	}{
+		{
+			name:  "account archive",
+			files: map[string]string{"weight-tracker.json": `{"format":"weight-tracker-archive","version":1,"weights":[]}`},
+			err:   "account archive",
+		},
+		{
+			name:  "generic CSV",
+			files: map[string]string{"weights.csv": "date,weight\n2023-01-01,80.5\n"},
+		},
+		{
+			name: "Fitbit months",
+			files: map[string]string{
+				"weight-2023-01-01.json": `[{"logId": 1, "weight": 176.4, "date": "01/01/23", "time": "07:30:00"}]`,
+				"weight-2023-02-01.json": "[]",
+			},
+			adapter: "fitbit",
+			rows:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter, content, rows, err := readUploads(uploadFiles(t, tt.files), "auto", time.UTC)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want one mentioning %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readUploads: %v", err)
+			}
+			if tt.adapter == "" {
+				if adapter != nil || len(content) == 0 {
+					t.Errorf("got adapter %v and %d bytes, want generic CSV content", adapter, len(content))
+				}
+				return
+			}
+			if adapter == nil || adapter.Key != tt.adapter {
+				t.Fatalf("adapter = %v, want %q", adapter, tt.adapter)
+			}
+			if len(rows) != tt.rows {
+				t.Errorf("got %d rows, want %d", len(rows), tt.rows)
+			}
+		})
+	}
+}
@@ -1,24 +1,29 @@
 package handlers
 
 import (
+	"database/sql"
 	"html/template"
 	"net/http"
 	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
 )
 
 type PageHandler struct {
-	tmpl *template.Template
+	weightRepo   *models.WeightRepository
+	goalRepo     *models.GoalRepository
+	settingsRepo *models.SettingsRepository
+	tmpl         *template.Template
 }
 
-func NewPageHandler() *PageHandler {
+func NewPageHandler(db *sql.DB) *PageHandler {
 	// Parse layout template first
-	layoutContent, err := template.ParseFiles("templates/layout.html")
+	layoutContent, err := template.New("layout.html").Funcs(templateFuncs).ParseFiles("templates/layout.html")
 	if err != nil {
 		panic(err)
 	}
 
 	// Parse home template
-	homeContent, err := template.ParseFiles("templates/home.html")
+	homeContent, err := template.New("home.html").Funcs(templateFuncs).ParseFiles("templates/home.html")
 	if err != nil {
 		panic(err)
 	}
@@ -38,7 +43,10 @@ func NewPageHandler() *PageHandler {
 	}
 
 	return &PageHandler{
-		tmpl: layoutContent,
+		weightRepo:   models.NewWeightRepository(db),
+		goalRepo:     models.NewGoalRepository(db),
+		settingsRepo: models.NewSettingsRepository(db),
+		tmpl:         layoutContent,
 	}
 }
 
@@ -48,8 +56,24 @@ func (h *PageHandler) Home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := middleware.GetUserID(r)
+	settings, err := h.settingsRepo.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
+
+	goal, err := loadGoalView(h.weightRepo, h.goalRepo, settings, userID)
+	if err != nil {
+		http.Error(w, "Failed to load goal", http.StatusInternalServerError)
+		return
+	}
+
 	data := map[string]interface{}{
-		"Title": "Home",
+		"Title":     "Home",
+		"CSRFToken": middleware.CSRFToken(r),
+		"CSPNonce":  middleware.CSPNonce(r),
+		"Goal":      goal,
 	}
 	h.tmpl.ExecuteTemplate(w, "base", data)
 }
@@ -57,4 +81,4 @@ func (h *PageHandler) Home(w http.ResponseWriter, r *http.Request) {
 func (h *PageHandler) NotFound(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 	h.tmpl.ExecuteTemplate(w, "404.html", nil)
-}
\ No newline at end of file
+}
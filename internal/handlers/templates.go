@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"html/template"
+	"weight-tracker/static"
+)
+
+// templateFuncs are available in every template. asset links to a file in
+// /static by its content-hashed name, e.g. {{asset "css/style.css"}}.
+var templateFuncs = template.FuncMap{
+	"asset": static.Path,
+}
+
+// newPageTemplate parses the layout together with a single page template and
+// the shared partials. Each page defines its own "content" block, so pages
+// can't share one template set.
+func newPageTemplate(page string) *template.Template {
+	tmpl := template.Must(template.New("layout.html").Funcs(templateFuncs).ParseFiles("templates/layout.html"))
+	tmpl = template.Must(tmpl.ParseFiles(page))
+	return template.Must(tmpl.ParseGlob("templates/partials/*.html"))
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"html/template"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,19 +13,20 @@ import (
 )
 
 type WeightHandler struct {
-	weightRepo *models.WeightRepository
-	tmpl       *template.Template
+	weightRepo   *models.WeightRepository
+	settingsRepo *models.SettingsRepository
+	tmpl         *template.Template
 }
 
 func NewWeightHandler(db *sql.DB) *WeightHandler {
 	// Parse layout template first
-	layoutContent, err := template.ParseFiles("templates/layout.html")
+	layoutContent, err := template.New("layout.html").Funcs(templateFuncs).ParseFiles("templates/layout.html")
 	if err != nil {
 		panic(err)
 	}
 
 	// Parse weights template
-	weightsContent, err := template.ParseFiles("templates/weights.html")
+	weightsContent, err := template.New("weights.html").Funcs(templateFuncs).ParseFiles("templates/weights.html")
 	if err != nil {
 		panic(err)
 	}
@@ -43,8 +46,9 @@ func NewWeightHandler(db *sql.DB) *WeightHandler {
 	}
 
 	return &WeightHandler{
-		weightRepo: models.NewWeightRepository(db),
-		tmpl:       layoutContent,
+		weightRepo:   models.NewWeightRepository(db),
+		settingsRepo: models.NewSettingsRepository(db),
+		tmpl:         layoutContent,
 	}
 }
 
@@ -61,17 +65,34 @@ func (h *WeightHandler) ShowWeights(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user has entry for today
-	today := time.Now().Format("2006-01-02")
-	todayWeight, _ := h.weightRepo.GetByDate(userID, today)
+	settings, err := h.settingsRepo.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return
+	}
+	loc := settings.Location()
+
+	// Check if user has entry for today; with multiple readings per day a
+	// new reading never replaces it
+	var todayWeight *weightRow
+	if !settings.AllowsMultiplePerDay() {
+		if today, err := h.weightRepo.GetByDate(userID, time.Now().In(loc)); err == nil {
+			todayWeight = &weightRow{Weight: *today, Unit: settings.Unit}
+		}
+	}
 
 	data := map[string]interface{}{
-		"Weights":      weights,
+		"Weights":       newWeightRows(weights, settings),
 		"HasTodayEntry": todayWeight != nil,
-		"TodayWeight":  todayWeight,
+		"TodayWeight":   todayWeight,
+		"Unit":          settings.Unit,
+		"MinWeight":     models.FromKg(models.MinWeightKg, settings.Unit),
+		"MaxWeight":     models.FromKg(models.MaxWeightKg, settings.Unit),
 	}
 
 	data["Title"] = "Weight History"
+	data["CSRFToken"] = middleware.CSRFToken(r)
+	data["CSPNonce"] = middleware.CSPNonce(r)
 	h.tmpl.ExecuteTemplate(w, "base", data)
 }
 
@@ -87,45 +108,50 @@ func (h *WeightHandler) CreateWeight(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	weightStr := r.FormValue("weight")
-	weight, err := strconv.ParseFloat(weightStr, 64)
-	if err != nil || weight <= 0 {
-		http.Error(w, "Invalid weight value", http.StatusBadRequest)
+	settings, err := h.settingsRepo.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
 		return
 	}
+	loc := settings.Location()
 
-	if weight < 20 || weight > 500 {
-		http.Error(w, "Weight must be between 20 and 500 kg", http.StatusBadRequest)
+	// The form is filled in using the user's unit; storage is in kg
+	weight, err := parseFormWeight(r, settings.Unit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	notes := r.FormValue("notes")
-	today := time.Now().Format("2006-01-02")
-
-	// Check if entry exists for today
-	existingWeight, err := h.weightRepo.GetByDate(userID, today)
-
-	if err == nil && existingWeight != nil {
-		// Update existing entry
-		existingWeight.WeightKg = weight
-		existingWeight.Notes = notes
-		if err := h.weightRepo.Update(existingWeight); err != nil {
-			http.Error(w, "Failed to update weight", http.StatusInternalServerError)
-			return
-		}
-	} else {
-		// Create new entry
-		newWeight := &models.Weight{
-			UserID:     userID,
-			WeightKg:   weight,
-			RecordedAt: time.Now(),
-			Notes:      notes,
-		}
-		if err := h.weightRepo.Create(newWeight); err != nil {
-			http.Error(w, "Failed to create weight", http.StatusInternalServerError)
+	// Readings default to now but may be backdated
+	recordedAt := time.Now().In(loc)
+	if v := r.FormValue("recorded_at"); v != "" {
+		recordedAt, err = parseRecordedAt(v, loc)
+		if err != nil {
+			http.Error(w, "Invalid date", http.StatusBadRequest)
 			return
 		}
 	}
+	if err := models.ValidateRecordedAt(recordedAt); err != nil {
+		http.Error(w, "Date can't be in the future", http.StatusBadRequest)
+		return
+	}
+
+	notes := r.FormValue("notes")
+	if len(notes) > models.MaxNotesLength {
+		http.Error(w, fmt.Sprintf("Notes must be at most %d characters", models.MaxNotesLength), http.StatusBadRequest)
+		return
+	}
+
+	newWeight := &models.Weight{
+		UserID:     userID,
+		WeightKg:   weight,
+		RecordedAt: recordedAt,
+		Notes:      notes,
+	}
+	if _, err := saveWeight(h.weightRepo, settings, newWeight); err != nil {
+		http.Error(w, "Failed to save weight", http.StatusInternalServerError)
+		return
+	}
 
 	// If HTMX request, return partial template
 	if r.Header.Get("HX-Request") == "true" {
@@ -136,10 +162,11 @@ func (h *WeightHandler) CreateWeight(w http.ResponseWriter, r *http.Request) {
 		}
 
 		data := map[string]interface{}{
-			"Weights": weights,
+			"Weights": newWeightRows(weights, settings),
 		}
 
-		h.tmpl.ExecuteTemplate(w, "weight_list.html", data)
+		w.Header().Set("HX-Trigger", "weights-changed")
+		h.tmpl.ExecuteTemplate(w, "weight_list", data)
 		return
 	}
 
@@ -166,11 +193,238 @@ func (h *WeightHandler) DeleteWeight(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// If HTMX request, return empty response
+	// If HTMX request, return an empty body so the row is swapped out
+	// (HTMX ignores 204 responses)
 	if r.Header.Get("HX-Request") == "true" {
-		w.WriteHeader(http.StatusNoContent)
+		w.Header().Set("HX-Trigger", "weights-changed")
+		w.WriteHeader(http.StatusOK)
 		return
 	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
\ No newline at end of file
+}
+
+// ShowWeightRow renders a single history row, e.g. when an edit is cancelled.
+func (h *WeightHandler) ShowWeightRow(w http.ResponseWriter, r *http.Request) {
+	weight, settings, ok := h.loadWeight(w, r)
+	if !ok {
+		return
+	}
+
+	h.tmpl.ExecuteTemplate(w, "weight_row", weightRow{Weight: *weight, Unit: settings.Unit})
+}
+
+// EditWeight swaps a history row for an inline edit form.
+func (h *WeightHandler) EditWeight(w http.ResponseWriter, r *http.Request) {
+	weight, settings, ok := h.loadWeight(w, r)
+	if !ok {
+		return
+	}
+
+	h.tmpl.ExecuteTemplate(w, "weight_row_edit", map[string]interface{}{
+		"Weight": weightRow{Weight: *weight, Unit: settings.Unit},
+	})
+}
+
+// UpdateWeight saves an inline edit and returns the updated row. Validation
+// errors re-render the edit form so the user can correct them.
+func (h *WeightHandler) UpdateWeight(w http.ResponseWriter, r *http.Request) {
+	weight, settings, ok := h.loadWeight(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	renderError := func(msg string) {
+		h.tmpl.ExecuteTemplate(w, "weight_row_edit", map[string]interface{}{
+			"Weight": weightRow{Weight: *weight, Unit: settings.Unit},
+			"Error":  msg,
+		})
+	}
+
+	value, err := parseFormWeight(r, settings.Unit)
+	if err != nil {
+		renderError(err.Error())
+		return
+	}
+
+	loc := settings.Location()
+	recordedAt, err := parseRecordedAt(r.FormValue("recorded_at"), loc)
+	if err != nil {
+		renderError("Invalid date")
+		return
+	}
+	if err := models.ValidateRecordedAt(recordedAt); err != nil {
+		renderError("Date can't be in the future")
+		return
+	}
+
+	notes := r.FormValue("notes")
+	if len(notes) > models.MaxNotesLength {
+		renderError("Notes must be at most 500 characters")
+		return
+	}
+
+	// Keep one entry per day when an entry is moved to another date
+	movedDay := !models.StartOfDay(recordedAt).Equal(models.StartOfDay(weight.RecordedAt))
+	if !settings.AllowsMultiplePerDay() && movedDay {
+		if other, err := h.weightRepo.GetByDate(weight.UserID, recordedAt); err == nil && other.ID != weight.ID {
+			renderError("There is already an entry for " + recordedAt.Format("Jan 02, 2006"))
+			return
+		}
+	}
+
+	weight.WeightKg = value
+	weight.RecordedAt = recordedAt
+	weight.Notes = notes
+	if err := h.weightRepo.Update(weight); err != nil {
+		http.Error(w, "Failed to update weight", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Trigger", "weights-changed")
+	h.tmpl.ExecuteTemplate(w, "weight_row", weightRow{Weight: *weight, Unit: settings.Unit})
+}
+
+// saveWeight stores a new reading according to the user's entry mode: either
+// as an extra entry or as the day's single entry, overwriting any existing
+// one. It reports whether a new row was created.
+func saveWeight(repo *models.WeightRepository, settings *models.Settings, weight *models.Weight) (bool, error) {
+	if settings.AllowsMultiplePerDay() {
+		return true, repo.Create(weight)
+	}
+	return repo.SaveForDay(weight)
+}
+
+// parseRecordedAt reads a date from a form in the user's timezone, either a
+// datetime-local value or a bare date, which is taken as noon.
+func parseRecordedAt(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02T15:04", value, loc); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Add(12 * time.Hour), nil
+}
+
+// loadWeight fetches the current user's entry named by the {id} path value,
+// with its timestamp in the user's timezone, along with the user's settings.
+// It writes an error response if it can't.
+func (h *WeightHandler) loadWeight(w http.ResponseWriter, r *http.Request) (*models.Weight, *models.Settings, bool) {
+	userID := middleware.GetUserID(r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	weightID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid weight ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	weight, err := h.weightRepo.GetByID(weightID, userID)
+	if err != nil {
+		http.Error(w, "Weight not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	settings, err := h.settingsRepo.Get(userID)
+	if err != nil {
+		http.Error(w, "Failed to load settings", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	weight.RecordedAt = weight.RecordedAt.In(settings.Location())
+	return weight, settings, true
+}
+
+// weightRow is an entry prepared for display in the user's unit.
+type weightRow struct {
+	models.Weight
+	Unit string
+}
+
+// Display renders the weight with its unit, e.g. "12 st 8.8 lb".
+func (w weightRow) Display() string {
+	return models.FormatWeight(w.WeightKg, w.Unit)
+}
+
+// Value is the weight in the user's unit, for prefilling inputs.
+func (w weightRow) Value() float64 {
+	return models.FromKg(w.WeightKg, w.Unit)
+}
+
+func (w weightRow) Stones() int {
+	stones, _ := models.StonesAndPounds(w.WeightKg)
+	return stones
+}
+
+func (w weightRow) Pounds() float64 {
+	_, pounds := models.StonesAndPounds(w.WeightKg)
+	return pounds
+}
+
+// newWeightRows prepares entries for display with the user's timezone and unit.
+func newWeightRows(weights []models.Weight, settings *models.Settings) []weightRow {
+	loc := settings.Location()
+	rows := make([]weightRow, 0, len(weights))
+	for _, weight := range weights {
+		weight.RecordedAt = weight.RecordedAt.In(loc)
+		rows = append(rows, weightRow{Weight: weight, Unit: settings.Unit})
+	}
+	return rows
+}
+
+// parseFormWeight reads a weight entered in unit and returns it in kg. Stones
+// are entered as separate "stones" and "pounds" fields, other units as a
+// single "weight" field.
+func parseFormWeight(r *http.Request, unit string) (float64, error) {
+	var kg float64
+	if unit == models.UnitSt {
+		stones, err := parseFiniteFloat(r.FormValue("stones"))
+		if err != nil || stones < 0 {
+			return 0, fmt.Errorf("Invalid weight value")
+		}
+		pounds := 0.0
+		if v := r.FormValue("pounds"); v != "" {
+			pounds, err = parseFiniteFloat(v)
+			if err != nil || pounds < 0 || pounds >= 14 {
+				return 0, fmt.Errorf("Pounds must be between 0 and 14")
+			}
+		}
+		kg = models.ToKg(stones, models.UnitSt) + models.ToKg(pounds, models.UnitLb)
+	} else {
+		value, err := parseFiniteFloat(r.FormValue("weight"))
+		if err != nil || value <= 0 {
+			return 0, fmt.Errorf("Invalid weight value")
+		}
+		kg = models.ToKg(value, unit)
+	}
+
+	if kg < models.MinWeightKg || kg > models.MaxWeightKg {
+		return 0, fmt.Errorf("Weight must be between %s and %s",
+			models.FormatWeight(models.MinWeightKg, unit), models.FormatWeight(models.MaxWeightKg, unit))
+	}
+	return kg, nil
+}
+
+// parseFiniteFloat parses a number typed into a form. ParseFloat also accepts
+// "NaN" and "Inf", which would slip past every range check.
+func parseFiniteFloat(value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%q is not a number", value)
+	}
+	return f, nil
+}
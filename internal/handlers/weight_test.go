@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"weight-tracker/internal/middleware"
+	"weight-tracker/internal/models"
+)
+
+func TestCreateWeightLimitsNotes(t *testing.T) {
+	db := newTestDB(t)
+	alice := mustCreateUser(t, db, "alice")
+	handler := NewWeightHandler(db)
+
+	tests := []struct {
+		notes string
+		want  int
+	}{
+		{strings.Repeat("a", models.MaxNotesLength+1), http.StatusBadRequest},
+		{strings.Repeat("a", models.MaxNotesLength), http.StatusSeeOther},
+	}
+	for _, tt := range tests {
+		form := url.Values{"weight": {"80"}, "notes": {tt.notes}}
+		req := httptest.NewRequest(http.MethodPost, "/weights", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, alice.ID))
+		rec := httptest.NewRecorder()
+		handler.CreateWeight(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%d characters: status = %d, want %d", len(tt.notes), rec.Code, tt.want)
+		}
+	}
+
+	count, err := models.NewWeightRepository(db).Count(alice.ID)
+	if err != nil {
+		t.Fatalf("count weights: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("stored %d entries, want 1", count)
+	}
+}
+
+func TestParseFormWeight(t *testing.T) {
+	tests := []struct {
+		unit   string
+		form   url.Values
+		wantKg float64 // 0 when the value is rejected
+	}{
+		{models.UnitKg, url.Values{"weight": {"80.5"}}, 80.5},
+		{models.UnitLb, url.Values{"weight": {"176.4"}}, 176.4 * 0.45359237},
+		{models.UnitSt, url.Values{"stones": {"12"}, "pounds": {"8.4"}}, 176.4 * 0.45359237},
+		{models.UnitSt, url.Values{"stones": {"12"}}, 168 * 0.45359237},
+		{models.UnitKg, url.Values{"weight": {""}}, 0},
+		{models.UnitKg, url.Values{"weight": {"5"}}, 0},
+		{models.UnitSt, url.Values{"stones": {"12"}, "pounds": {"14"}}, 0},
+		{models.UnitKg, url.Values{"weight": {"NaN"}}, 0},
+		{models.UnitLb, url.Values{"weight": {"Inf"}}, 0},
+		{models.UnitSt, url.Values{"stones": {"nan"}}, 0},
+		{models.UnitSt, url.Values{"stones": {"12"}, "pounds": {"NaN"}}, 0},
+		{models.UnitSt, url.Values{"stones": {"-Inf"}, "pounds": {"5"}}, 0},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/weights", strings.NewReader(tt.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		kg, err := parseFormWeight(req, tt.unit)
+		if tt.wantKg == 0 {
+			if err == nil {
+				t.Errorf("%s %v: got %v kg, want an error", tt.unit, tt.form, kg)
+			}
+			continue
+		}
+		if err != nil || math.Abs(kg-tt.wantKg) > 1e-9 {
+			t.Errorf("%s %v = %v kg (err %v), want %v", tt.unit, tt.form, kg, err, tt.wantKg)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package importer
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Adapter reads the export format of a particular app. Each returns one row
+// per reading, with the weight converted to kg and a time in the right zone.
+type Adapter struct {
+	Key   string
+	Label string
+	// Parse reads the export. loc is used for times the format stores
+	// without an offset.
+	Parse func(r io.Reader, loc *time.Location) ([]Row, error)
+
+	matches func(name string, head []byte) bool
+}
+
+// Adapters are the supported app formats, in detection order.
+var Adapters = []Adapter{
+	{Key: "libra", Label: "Libra", Parse: ParseLibra, matches: isLibra},
+	{Key: "fitbit", Label: "Fitbit", Parse: ParseFitbit, matches: isFitbit},
+	{Key: "withings", Label: "Withings", Parse: ParseWithings, matches: isWithings},
+	{Key: "apple_health", Label: "Apple Health", Parse: ParseAppleHealth, matches: isAppleHealth},
+}
+
+// FindAdapter returns the adapter with the given key.
+func FindAdapter(key string) (Adapter, bool) {
+	for _, a := range Adapters {
+		if a.Key == key {
+			return a, true
+		}
+	}
+	return Adapter{}, false
+}
+
+// DetectAdapter picks an adapter from a file's first bytes, using the file
+// name only to decide between formats whose content is inconclusive. It
+// reports false for anything that should go through the generic CSV import.
+func DetectAdapter(name string, head []byte) (Adapter, bool) {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	for _, a := range Adapters {
+		if a.matches(name, head) {
+			return a, true
+		}
+	}
+	return Adapter{}, false
+}
+
+func firstLine(head []byte) string {
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		head = head[:i]
+	}
+	return strings.TrimSpace(string(head))
+}
+
+func isLibra(name string, head []byte) bool {
+	return bytes.HasPrefix(head, []byte("#Version:")) || bytes.Contains(head, []byte("#date;weight"))
+}
+
+// hasExt reports whether name has the extension ext, ignoring case.
+func hasExt(name, ext string) bool {
+	return strings.EqualFold(filepath.Ext(name), ext)
+}
+
+// isFitbit matches the arrays of weight logs Fitbit exports. A month without
+// readings is exported as an empty array, which only the name can identify.
+func isFitbit(name string, head []byte) bool {
+	if bytes.Contains(head, []byte(`"logId"`)) {
+		return true
+	}
+	return hasExt(name, ".json") && bytes.HasPrefix(bytes.TrimSpace(head), []byte("[")) &&
+		!bytes.Contains(head, []byte("{"))
+}
+
+func isWithings(name string, head []byte) bool {
+	line := firstLine(head)
+	return strings.HasPrefix(line, "Date,") && strings.Contains(line, `"Weight (`)
+}
+
+// isAppleHealth matches export.xml. Its document type declaration can be
+// longer than the head, in which case the file starts with it.
+func isAppleHealth(name string, head []byte) bool {
+	if bytes.Contains(head, []byte("<HealthData")) || bytes.Contains(head, []byte("<!DOCTYPE HealthData")) {
+		return true
+	}
+	return hasExt(name, ".xml") && bytes.HasPrefix(bytes.TrimSpace(head), []byte("<?xml")) &&
+		!bytes.Contains(head, []byte("<!DOCTYPE"))
+}
@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// wantRow is the expected outcome of one imported reading.
+type wantRow struct {
+	line     int
+	at       time.Time
+	weightKg float64
+	notes    string
+	err      bool
+}
+
+func parseFixture(t *testing.T, parse func(io.Reader, *time.Location) ([]Row, error), name string, loc *time.Location) []Row {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := parse(f, loc)
+	if err != nil {
+		t.Fatalf("parse %s: %v", name, err)
+	}
+	return rows
+}
+
+func checkRows(t *testing.T, rows []Row, want []wantRow) {
+	t.Helper()
+
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		row := rows[i]
+		if row.Line != w.line {
+			t.Errorf("row %d: line = %d, want %d", i, row.Line, w.line)
+		}
+		if w.err {
+			if row.Error == "" {
+				t.Errorf("row %d: expected an error", i)
+			}
+			continue
+		}
+		if row.Error != "" {
+			t.Errorf("row %d: unexpected error %q", i, row.Error)
+			continue
+		}
+		if !row.Weight.RecordedAt.Equal(w.at) {
+			t.Errorf("row %d: recorded at %v, want %v", i, row.Weight.RecordedAt, w.at.UTC())
+		}
+		if math.Abs(row.Weight.WeightKg-w.weightKg) > 0.001 {
+			t.Errorf("row %d: weight = %.4f kg, want %.4f", i, row.Weight.WeightKg, w.weightKg)
+		}
+		if row.Weight.Notes != w.notes {
+			t.Errorf("row %d: notes = %q, want %q", i, row.Weight.Notes, w.notes)
+		}
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	return loc
+}
+
+func utc(year int, month time.Month, day, hour, min, sec int) time.Time {
+	return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+}
+
+func TestParseLibra(t *testing.T) {
+	// Offsets in the file win over the user's timezone
+	rows := parseFixture(t, ParseLibra, "libra.csv", mustLoadLocation(t, "America/New_York"))
+	checkRows(t, rows, []wantRow{
+		{line: 5, at: utc(2023, 1, 1, 7, 30, 0), weightKg: 80.5},
+		{line: 6, at: utc(2023, 1, 2, 7, 15, 0), weightKg: 80.1, notes: "after run; felt good"},
+		{line: 7, err: true}, // Trend only, no weight
+		{line: 8, err: true},
+		{line: 9, err: true}, // NaN
+	})
+
+	rows = parseFixture(t, ParseLibra, "libra_lb.csv", time.UTC)
+	checkRows(t, rows, []wantRow{
+		{line: 5, at: utc(2023, 1, 1, 7, 30, 0), weightKg: 80.0134},
+	})
+}
+
+func TestParseFitbit(t *testing.T) {
+	// Fitbit times are local; Berlin is UTC+1 in January
+	rows := parseFixture(t, ParseFitbit, "fitbit.json", mustLoadLocation(t, "Europe/Berlin"))
+	checkRows(t, rows, []wantRow{
+		{line: 1, at: utc(2023, 1, 1, 6, 30, 0), weightKg: 80.0134},
+		{line: 2, at: utc(2023, 1, 2, 7, 30, 0), weightKg: 79.7412},
+		{line: 3, err: true}, // No weight
+	})
+}
+
+func TestParseWithings(t *testing.T) {
+	// Withings times are local; Tokyo is UTC+9
+	rows := parseFixture(t, ParseWithings, "withings.csv", mustLoadLocation(t, "Asia/Tokyo"))
+	checkRows(t, rows, []wantRow{
+		{line: 2, at: utc(2022, 12, 31, 22, 30, 0), weightKg: 80.5},
+		{line: 3, at: utc(2023, 1, 2, 14, 45, 10), weightKg: 80.2, notes: "late weigh-in"},
+		{line: 4, err: true}, // Below the minimum weight
+	})
+
+	rows = parseFixture(t, ParseWithings, "withings_lb.csv", time.UTC)
+	checkRows(t, rows, []wantRow{
+		{line: 2, at: utc(2023, 1, 1, 7, 30, 0), weightKg: 80.0134},
+	})
+}
+
+func TestParseAppleHealth(t *testing.T) {
+	rows := parseFixture(t, ParseAppleHealth, "apple_health.xml", time.UTC)
+	checkRows(t, rows, []wantRow{
+		{line: 10, at: utc(2023, 1, 1, 6, 30, 0), weightKg: 80.5},
+		{line: 11, at: utc(2023, 1, 2, 11, 0, 0), weightKg: 80.0134},
+		{line: 15, err: true}, // Unsupported unit
+	})
+}
+
+func TestDetectAdapter(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    string // Empty for generic CSV
+	}{
+		{"libra.csv", "libra"},
+		{"fitbit.json", "fitbit"},
+		{"withings.csv", "withings"},
+		{"apple_health.xml", "apple_health"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			head, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatalf("read fixture: %v", err)
+			}
+			a, ok := DetectAdapter("upload", head)
+			if !ok || a.Key != tt.want {
+				t.Errorf("DetectAdapter = %q, %v; want %q", a.Key, ok, tt.want)
+			}
+		})
+	}
+
+	byName := []struct {
+		name string
+		head string
+		want string // Empty for generic CSV
+	}{
+		{"weights.csv", "date,weight\n2023-01-01,80.5\n", ""},
+		{"weight-2023-02.json", "[ ]\n", "fitbit"},
+		{"archive.json", `{"format":"weight-tracker-archive","version":1,"weights":[]}`, ""},
+		{"export.xml", "<?xml version=\"1.0\"?>\n<!DOCTYPE HealthData [\n<!ELEMENT HealthData", "apple_health"},
+		{"route.xml", "<?xml version=\"1.0\"?>\n<!DOCTYPE gpx>\n<gpx>", ""},
+		{"weights.txt", `[{"logId": 1, "weight": 80.5}]`, "fitbit"},
+	}
+	for _, tt := range byName {
+		a, ok := DetectAdapter(tt.name, []byte(tt.head))
+		if tt.want == "" && ok {
+			t.Errorf("%s detected as %q", tt.name, a.Key)
+		}
+		if tt.want != "" && (!ok || a.Key != tt.want) {
+			t.Errorf("DetectAdapter(%s) = %q, %v; want %q", tt.name, a.Key, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"weight-tracker/internal/models"
+)
+
+const appleBodyMass = "HKQuantityTypeIdentifierBodyMass"
+
+// ParseAppleHealth reads the body mass records from an Apple Health
+// export.xml:
+//
+//	<Record type="HKQuantityTypeIdentifierBodyMass" sourceName="Health" unit="kg"
+//	        startDate="2023-01-01 07:30:00 +0100" value="80.5"/>
+//
+// Exports hold every kind of health record and can be very large, so the
+// file is streamed and everything else is skipped. Dates carry their own
+// offset.
+func ParseAppleHealth(r io.Reader, loc *time.Location) ([]Row, error) {
+	decoder := xml.NewDecoder(r)
+	// Exports declare an internal DTD that the decoder doesn't need
+	decoder.Strict = false
+
+	var rows []Row
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid Apple Health XML: %w", err)
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok || element.Name.Local != "Record" {
+			continue
+		}
+
+		attrs := map[string]string{}
+		for _, a := range element.Attr {
+			attrs[a.Name.Local] = a.Value
+		}
+		if attrs["type"] != appleBodyMass {
+			continue
+		}
+
+		line, _ := decoder.InputPos()
+		rows = append(rows, appleHealthRow(line, attrs))
+	}
+
+	return rows, nil
+}
+
+func appleHealthRow(line int, attrs map[string]string) Row {
+	row := Row{Line: line}
+
+	recordedAt, err := time.Parse("2006-01-02 15:04:05 -0700", attrs["startDate"])
+	if err != nil {
+		row.Error = fmt.Sprintf("invalid date %q", attrs["startDate"])
+		return row
+	}
+	row.Weight.RecordedAt = recordedAt
+
+	value, err := strconv.ParseFloat(attrs["value"], 64)
+	if err != nil {
+		row.Error = fmt.Sprintf("invalid weight %q", attrs["value"])
+		return row
+	}
+
+	switch unit := attrs["unit"]; unit {
+	case "kg":
+		row.Weight.WeightKg = value
+	case "g":
+		row.Weight.WeightKg = value / 1000
+	case "lb":
+		row.Weight.WeightKg = models.ToKg(value, models.UnitLb)
+	case "st":
+		row.Weight.WeightKg = models.ToKg(value, models.UnitSt)
+	default:
+		row.Error = fmt.Sprintf("unknown unit %q", unit)
+		return row
+	}
+
+	row.Validate()
+	return row
+}
@@ -0,0 +1,507 @@
+// Package importer reads weight history exported from spreadsheets and other
+// apps.
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"weight-tracker/internal/models"
+)
+
+// NoColumn marks an optional column that isn't mapped.
+const NoColumn = -1
+
+// detectSampleSize is how many rows detection looks at.
+const detectSampleSize = 200
+
+// DateFormat is a date layout the importer recognises.
+type DateFormat struct {
+	Key    string
+	Label  string
+	Layout string
+}
+
+// DateFormats are tried in order; earlier formats win ties during detection.
+var DateFormats = []DateFormat{
+	{"iso", "YYYY-MM-DD", "2006-01-02"},
+	{"dmy", "DD/MM/YYYY", "2/1/2006"},
+	{"mdy", "MM/DD/YYYY", "1/2/2006"},
+	{"dmy_dot", "DD.MM.YYYY", "2.1.2006"},
+	{"dmy_dash", "DD-MM-YYYY", "2-1-2006"},
+	{"ymd_slash", "YYYY/MM/DD", "2006/1/2"},
+}
+
+// timeLayouts are accepted for times, either in their own column or after
+// the date.
+var timeLayouts = []string{"15:04", "15:04:05", "3:04 PM", "3:04PM", "3:04:05 PM", "15:04:05Z07:00"}
+
+func dateFormat(key string) (DateFormat, bool) {
+	for _, f := range DateFormats {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return DateFormat{}, false
+}
+
+// Record is one line of the file.
+type Record struct {
+	Line   int
+	Fields []string
+}
+
+// File is a parsed CSV file.
+type File struct {
+	Records []Record
+}
+
+// Read parses CSV data. The delimiter (comma, semicolon or tab) is taken from
+// whichever is most common in the first line.
+func Read(data []byte) (*File, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	delimiter := ','
+	best := bytes.Count(firstLine, []byte(","))
+	for _, d := range []rune{';', '\t'} {
+		if n := bytes.Count(firstLine, []byte(string(d))); n > best {
+			delimiter, best = d, n
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	file := &File{}
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if isBlank(fields) {
+			continue
+		}
+		file.Records = append(file.Records, Record{Line: line, Fields: fields})
+	}
+
+	if len(file.Records) == 0 {
+		return nil, errors.New("the file has no rows")
+	}
+	return file, nil
+}
+
+func isBlank(fields []string) bool {
+	for _, f := range fields {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Width returns the number of columns in the widest row.
+func (f *File) Width() int {
+	width := 0
+	for _, r := range f.Records {
+		if len(r.Fields) > width {
+			width = len(r.Fields)
+		}
+	}
+	return width
+}
+
+// Columns returns a name for each column: the header cell when the file has
+// a header, otherwise "Column N".
+func (f *File) Columns(hasHeader bool) []string {
+	columns := make([]string, f.Width())
+	for i := range columns {
+		columns[i] = fmt.Sprintf("Column %d", i+1)
+		if hasHeader && i < len(f.Records[0].Fields) && strings.TrimSpace(f.Records[0].Fields[i]) != "" {
+			columns[i] = strings.TrimSpace(f.Records[0].Fields[i])
+		}
+	}
+	return columns
+}
+
+// Mapping says how to read the file's columns.
+type Mapping struct {
+	HasHeader    bool
+	DateColumn   int
+	TimeColumn   int // NoColumn when times are in the date column or absent
+	WeightColumn int
+	NotesColumn  int // NoColumn when there are no notes
+	DateFormat   string
+	Unit         string
+}
+
+// Validate checks that the mapping fits the file.
+func (m Mapping) Validate(f *File) error {
+	width := f.Width()
+	if m.DateColumn < 0 || m.DateColumn >= width {
+		return errors.New("choose the date column")
+	}
+	if m.WeightColumn < 0 || m.WeightColumn >= width {
+		return errors.New("choose the weight column")
+	}
+	if m.DateColumn == m.WeightColumn {
+		return errors.New("date and weight must be different columns")
+	}
+	if m.TimeColumn < NoColumn || m.TimeColumn >= width {
+		return errors.New("invalid time column")
+	}
+	if m.NotesColumn < NoColumn || m.NotesColumn >= width {
+		return errors.New("invalid notes column")
+	}
+	if _, ok := dateFormat(m.DateFormat); !ok {
+		return errors.New("choose a date format")
+	}
+	if !models.ValidUnit(m.Unit) {
+		return errors.New("choose a unit")
+	}
+	return nil
+}
+
+// Detect guesses the mapping from the header names and the values in the
+// file. The result always passes Validate when the file has two or more
+// columns; the user can correct it in the preview.
+func Detect(f *File) Mapping {
+	m := Mapping{
+		DateColumn:   NoColumn,
+		TimeColumn:   NoColumn,
+		WeightColumn: NoColumn,
+		NotesColumn:  NoColumn,
+		DateFormat:   DateFormats[0].Key,
+		Unit:         models.UnitKg,
+	}
+
+	m.HasHeader = looksLikeHeader(f.Records[0].Fields)
+	rows := f.Records
+	if m.HasHeader {
+		rows = rows[1:]
+		detectByHeader(f.Records[0].Fields, &m)
+	}
+	if len(rows) > detectSampleSize {
+		rows = rows[:detectSampleSize]
+	}
+
+	// Fall back to the values for anything the header didn't name
+	width := f.Width()
+	if m.DateColumn == NoColumn {
+		for col := 0; col < width; col++ {
+			if col != m.WeightColumn && parsesMostly(rows, col, isDate) {
+				m.DateColumn = col
+				break
+			}
+		}
+	}
+	if m.WeightColumn == NoColumn {
+		for col := 0; col < width; col++ {
+			if col != m.DateColumn && col != m.TimeColumn && parsesMostly(rows, col, isWeight) {
+				m.WeightColumn = col
+				break
+			}
+		}
+	}
+	if m.DateColumn == NoColumn {
+		m.DateColumn = 0
+	}
+	if m.WeightColumn == NoColumn || m.WeightColumn == m.DateColumn {
+		m.WeightColumn = (m.DateColumn + 1) % max(width, 2)
+	}
+
+	m.DateFormat = detectDateFormat(rows, m.DateColumn)
+	if !m.unitFromHeader(f) {
+		m.Unit = detectUnit(rows, m.WeightColumn)
+	}
+
+	return m
+}
+
+// unitFromHeader sets the unit from the weight column's header, if it names
+// one.
+func (m *Mapping) unitFromHeader(f *File) bool {
+	if !m.HasHeader || m.WeightColumn >= len(f.Records[0].Fields) {
+		return false
+	}
+	if unit := unitInText(f.Records[0].Fields[m.WeightColumn]); unit != "" {
+		m.Unit = unit
+		return true
+	}
+	return false
+}
+
+var wordPattern = regexp.MustCompile(`[a-z]+`)
+
+// unitInText finds a unit named as a word in text, e.g. "Weight (lbs)".
+func unitInText(text string) string {
+	for _, word := range wordPattern.FindAllString(strings.ToLower(text), -1) {
+		switch word {
+		case "kg", "kgs", "kilograms", "kilo", "kilos":
+			return models.UnitKg
+		case "lb", "lbs", "pound", "pounds":
+			return models.UnitLb
+		case "st", "stone", "stones":
+			return models.UnitSt
+		}
+	}
+	return ""
+}
+
+func looksLikeHeader(fields []string) bool {
+	for _, field := range fields {
+		if isDate(field) || isWeight(field) {
+			return false
+		}
+	}
+	return true
+}
+
+func detectByHeader(header []string, m *Mapping) {
+	for col, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case m.WeightColumn == NoColumn && (strings.Contains(name, "weight") || strings.Contains(name, "mass") ||
+			name == "kg" || name == "lb" || name == "lbs"):
+			m.WeightColumn = col
+		case m.NotesColumn == NoColumn && (strings.Contains(name, "note") || strings.Contains(name, "comment")):
+			m.NotesColumn = col
+		case name == "time":
+			m.TimeColumn = col
+		case m.DateColumn == NoColumn && (strings.Contains(name, "date") || strings.Contains(name, "day") ||
+			strings.Contains(name, "timestamp") || strings.Contains(name, "recorded")):
+			m.DateColumn = col
+		}
+	}
+
+	// A lone "time" column holds the whole timestamp
+	if m.DateColumn == NoColumn && m.TimeColumn != NoColumn {
+		m.DateColumn, m.TimeColumn = m.TimeColumn, NoColumn
+	}
+}
+
+func field(r Record, col int) string {
+	if col < 0 || col >= len(r.Fields) {
+		return ""
+	}
+	return strings.TrimSpace(r.Fields[col])
+}
+
+// parsesMostly reports whether at least 80% of the non-empty values in the
+// column pass ok.
+func parsesMostly(rows []Record, col int, ok func(string) bool) bool {
+	total, passed := 0, 0
+	for _, r := range rows {
+		v := field(r, col)
+		if v == "" {
+			continue
+		}
+		total++
+		if ok(v) {
+			passed++
+		}
+	}
+	return total > 0 && passed*5 >= total*4
+}
+
+func isDate(v string) bool {
+	for _, f := range DateFormats {
+		if _, err := parseTimestamp(v, "", f, time.UTC); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func isWeight(v string) bool {
+	value, _, err := parseNumber(v)
+	return err == nil && value > 0
+}
+
+func detectDateFormat(rows []Record, col int) string {
+	best, bestCount := DateFormats[0].Key, 0
+	for _, f := range DateFormats {
+		count := 0
+		for _, r := range rows {
+			if _, err := parseTimestamp(field(r, col), "", f, time.UTC); err == nil {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = f.Key, count
+		}
+	}
+	return best
+}
+
+// detectUnit uses units written next to the values if there are any, and
+// otherwise the typical size of the values.
+func detectUnit(rows []Record, col int) string {
+	var values []float64
+	for _, r := range rows {
+		value, unit, err := parseNumber(field(r, col))
+		if err != nil {
+			continue
+		}
+		if unit != "" {
+			return unit
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return models.UnitKg
+	}
+
+	sort.Float64s(values)
+	median := values[len(values)/2]
+	switch {
+	case median < models.MinWeightKg:
+		return models.UnitSt
+	case median > 150:
+		return models.UnitLb
+	}
+	return models.UnitKg
+}
+
+var (
+	stonesPattern = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)\s*(?:st|stone|stones)\s*(?:(\d+(?:[.,]\d+)?)\s*(?:lb|lbs|pounds?)?)?$`)
+	numberPattern = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)\s*([a-z]*)$`)
+)
+
+// parseNumber reads a weight cell such as "80.5", "80,5", "177 lbs" or
+// "12 st 8 lb". Stones and pounds are returned as decimal stones. The unit is
+// empty when the cell doesn't name one.
+func parseNumber(v string) (float64, string, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+
+	if m := stonesPattern.FindStringSubmatch(v); m != nil {
+		stones, _ := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+		pounds := 0.0
+		if m[2] != "" {
+			pounds, _ = strconv.ParseFloat(strings.Replace(m[2], ",", ".", 1), 64)
+		}
+		return stones + pounds/14, models.UnitSt, nil
+	}
+
+	m := numberPattern.FindStringSubmatch(v)
+	if m == nil {
+		return 0, "", fmt.Errorf("invalid weight %q", v)
+	}
+	value, err := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid weight %q", v)
+	}
+
+	unit := ""
+	if m[2] != "" {
+		if unit = unitInText(m[2]); unit == "" {
+			return 0, "", fmt.Errorf("unknown unit %q", m[2])
+		}
+	}
+	return value, unit, nil
+}
+
+// parseTimestamp reads a date, optionally followed by a time, plus an
+// optional separate time. Values without an offset are in loc, and bare
+// dates are taken as noon, like dates entered in the form.
+func parseTimestamp(dateValue, timeValue string, format DateFormat, loc *time.Location) (time.Time, error) {
+	dateValue = strings.TrimSpace(dateValue)
+	timeValue = strings.TrimSpace(timeValue)
+	if dateValue == "" {
+		return time.Time{}, errors.New("missing date")
+	}
+
+	if format.Key == "iso" && timeValue == "" {
+		if t, err := time.Parse(time.RFC3339, dateValue); err == nil {
+			return t, nil
+		}
+	}
+
+	datePart, timePart := dateValue, ""
+	if i := strings.IndexAny(dateValue, " T"); i > 0 {
+		datePart, timePart = dateValue[:i], strings.TrimSpace(dateValue[i+1:])
+	}
+	date, err := time.ParseInLocation(format.Layout, datePart, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date %q doesn't match %s", dateValue, format.Label)
+	}
+
+	if timeValue != "" {
+		timePart = timeValue
+	}
+	if timePart == "" {
+		return date.Add(12 * time.Hour), nil
+	}
+
+	for _, layout := range timeLayouts {
+		t, err := time.Parse(layout, strings.ToUpper(timePart))
+		if err != nil {
+			continue
+		}
+		zone := loc
+		if strings.Contains(layout, "Z07") {
+			_, offset := t.Zone()
+			zone = time.FixedZone("", offset)
+		}
+		return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), t.Second(), 0, zone), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", timePart)
+}
+
+// Rows reads every record with the mapping. Times without an offset are taken
+// in loc. The mapping must have passed Validate.
+func (f *File) Rows(m Mapping, loc *time.Location) []Row {
+	format, _ := dateFormat(m.DateFormat)
+
+	records := f.Records
+	if m.HasHeader {
+		records = records[1:]
+	}
+
+	rows := make([]Row, 0, len(records))
+	for _, r := range records {
+		row := Row{Line: r.Line}
+		row.Weight.Notes = field(r, m.NotesColumn)
+
+		recordedAt, err := parseTimestamp(field(r, m.DateColumn), field(r, m.TimeColumn), format, loc)
+		if err != nil {
+			row.Error = err.Error()
+			rows = append(rows, row)
+			continue
+		}
+		row.Weight.RecordedAt = recordedAt
+
+		value, unit, err := parseNumber(field(r, m.WeightColumn))
+		if err != nil {
+			row.Error = err.Error()
+			rows = append(rows, row)
+			continue
+		}
+		if unit == "" {
+			unit = m.Unit
+		}
+		row.Weight.WeightKg = models.ToKg(value, unit)
+
+		row.Validate()
+		rows = append(rows, row)
+	}
+
+	return rows
+}
@@ -0,0 +1,229 @@
+package importer
+
+import (
+	"math"
+	"testing"
+	"time"
+	"weight-tracker/internal/models"
+)
+
+func mustRead(t *testing.T, data string) *File {
+	t.Helper()
+
+	f, err := Read([]byte(data))
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	return f
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Mapping
+	}{
+		{
+			name: "header names the columns and unit",
+			data: "Notes;Weight (lbs);Date\nmorning;176,4;2023-01-01\n;175,8;2023-01-02\n",
+			want: Mapping{HasHeader: true, DateColumn: 2, TimeColumn: NoColumn, WeightColumn: 1, NotesColumn: 0, DateFormat: "iso", Unit: models.UnitLb},
+		},
+		{
+			name: "separate time column",
+			data: "date,time,weight,comment\n01/02/2023,07:30,80.5,\n",
+			want: Mapping{HasHeader: true, DateColumn: 0, TimeColumn: 1, WeightColumn: 2, NotesColumn: 3, DateFormat: "dmy", Unit: models.UnitKg},
+		},
+		{
+			name: "lone time column is the timestamp",
+			data: "time,kg\n2023-01-01 07:30,80.5\n",
+			want: Mapping{HasHeader: true, DateColumn: 0, TimeColumn: NoColumn, WeightColumn: 1, NotesColumn: NoColumn, DateFormat: "iso", Unit: models.UnitKg},
+		},
+		{
+			name: "no header, columns found by value",
+			data: "80.5\t2023-01-01\n80.1\t2023-01-02\n",
+			want: Mapping{HasHeader: false, DateColumn: 1, TimeColumn: NoColumn, WeightColumn: 0, NotesColumn: NoColumn, DateFormat: "iso", Unit: models.UnitKg},
+		},
+		{
+			name: "units in the cells",
+			data: "15.01.2023,12 st 8 lb\n16.01.2023,12 st 7\n",
+			want: Mapping{HasHeader: false, DateColumn: 0, TimeColumn: NoColumn, WeightColumn: 1, NotesColumn: NoColumn, DateFormat: "dmy_dot", Unit: models.UnitSt},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := mustRead(t, tt.data)
+			got := Detect(f)
+			if got != tt.want {
+				t.Errorf("Detect = %+v, want %+v", got, tt.want)
+			}
+			if err := got.Validate(f); err != nil {
+				t.Errorf("detected mapping is invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestDetectDateFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		dates []string
+		want  string
+	}{
+		{"ambiguous prefers day first", []string{"01/02/2023", "03/04/2023"}, "dmy"},
+		{"day above twelve", []string{"01/02/2023", "13/02/2023"}, "dmy"},
+		{"month first when the day is above twelve", []string{"01/02/2023", "03/04/2023", "02/13/2023", "02/14/2023"}, "mdy"},
+		{"dashes", []string{"25-12-2022"}, "dmy_dash"},
+		{"year first with slashes", []string{"2022/12/25"}, "ymd_slash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := make([]Record, len(tt.dates))
+			for i, d := range tt.dates {
+				rows[i] = Record{Line: i + 1, Fields: []string{d}}
+			}
+			if got := detectDateFormat(rows, 0); got != tt.want {
+				t.Errorf("detectDateFormat = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		in    string
+		value float64
+		unit  string
+		err   bool
+	}{
+		{in: "80.5", value: 80.5},
+		{in: "80,5", value: 80.5},
+		{in: " 80 ", value: 80},
+		{in: "177 lbs", value: 177, unit: models.UnitLb},
+		{in: "80.5kg", value: 80.5, unit: models.UnitKg},
+		{in: "12 st 8 lb", value: 12 + 8.0/14, unit: models.UnitSt},
+		{in: "12st 8", value: 12 + 8.0/14, unit: models.UnitSt},
+		{in: "12 stone", value: 12, unit: models.UnitSt},
+		{in: "12,5 st 3,5 lbs", value: 12.5 + 3.5/14, unit: models.UnitSt},
+		{in: "80 oz", err: true},
+		{in: "eighty", err: true},
+		{in: "-80", err: true},
+		{in: "", err: true},
+	}
+
+	for _, tt := range tests {
+		value, unit, err := parseNumber(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseNumber(%q) = %v %q, want an error", tt.in, value, unit)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseNumber(%q): %v", tt.in, err)
+			continue
+		}
+		if math.Abs(value-tt.value) > 1e-9 || unit != tt.unit {
+			t.Errorf("parseNumber(%q) = %v %q, want %v %q", tt.in, value, unit, tt.value, tt.unit)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	dmy, _ := dateFormat("dmy")
+	mdy, _ := dateFormat("mdy")
+	iso, _ := dateFormat("iso")
+
+	tests := []struct {
+		name      string
+		date, tod string
+		format    DateFormat
+		want      time.Time
+		err       bool
+	}{
+		{name: "day first", date: "03/04/2023", format: dmy, want: utc(2023, 4, 3, 10, 0, 0)},
+		{name: "month first", date: "03/04/2023", format: mdy, want: utc(2023, 3, 4, 11, 0, 0)},
+		{name: "no such month", date: "04/13/2023", format: dmy, err: true},
+		{name: "time after the date", date: "2023-01-15 07:30", format: iso, want: utc(2023, 1, 15, 6, 30, 0)},
+		{name: "time column", date: "15/01/2023", tod: "7:30 pm", format: dmy, want: utc(2023, 1, 15, 18, 30, 0)},
+		{name: "RFC 3339 keeps its offset", date: "2023-01-15T07:30:00-05:00", format: iso, want: utc(2023, 1, 15, 12, 30, 0)},
+		{name: "bad time", date: "2023-01-15", tod: "25:00", format: iso, err: true},
+		{name: "missing date", tod: "07:30", format: iso, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimestamp(tt.date, tt.tod, tt.format, berlin)
+			if tt.err {
+				if err == nil {
+					t.Errorf("parseTimestamp = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTimestamp: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseTimestamp = %v, want %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectUnit(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   string
+	}{
+		{"kilograms", []string{"80.5", "81", "79.8"}, models.UnitKg},
+		{"pounds", []string{"176", "178.5", "175"}, models.UnitLb},
+		{"stones", []string{"12.5", "12.6", "12.4"}, models.UnitSt},
+		{"median ignores a stray pound value", []string{"80", "81", "180"}, models.UnitKg},
+		{"median ignores a stray kilogram value", []string{"176", "80", "178"}, models.UnitLb},
+		{"unit in a cell wins", []string{"80", "176 lb"}, models.UnitLb},
+		{"nothing readable", []string{"n/a", ""}, models.UnitKg},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := make([]Record, len(tt.values))
+			for i, v := range tt.values {
+				rows[i] = Record{Line: i + 1, Fields: []string{v}}
+			}
+			if got := detectUnit(rows, 0); got != tt.want {
+				t.Errorf("detectUnit = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileRows(t *testing.T) {
+	f := mustRead(t, "date;weight;notes\n"+
+		"15/01/2023;80,5;morning\n"+
+		"16/01/2023;12 st 8 lb;\n"+
+		"17/01/2023;80 oz;\n"+
+		"2023-01-18;80;\n"+
+		"19/01/2023;5;\n"+
+		"\n"+
+		"20/01/2023;;\n")
+	m := Detect(f)
+	if m.DateFormat != "dmy" || m.Unit != models.UnitSt {
+		t.Fatalf("Detect = %+v", m)
+	}
+	// Cells without a unit are in the mapping's unit, as corrected in the
+	// preview
+	m.Unit = models.UnitKg
+
+	rows := f.Rows(m, time.UTC)
+	checkRows(t, rows, []wantRow{
+		{line: 2, at: utc(2023, 1, 15, 12, 0, 0), weightKg: 80.5, notes: "morning"},
+		{line: 3, at: utc(2023, 1, 16, 12, 0, 0), weightKg: models.ToKg(12+8.0/14, models.UnitSt)},
+		{line: 4, err: true}, // Unknown unit
+		{line: 5, err: true}, // Wrong date format
+		{line: 6, err: true}, // Below the minimum weight
+		{line: 8, err: true}, // No weight
+	})
+}
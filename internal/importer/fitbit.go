@@ -0,0 +1,55 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"weight-tracker/internal/models"
+)
+
+type fitbitEntry struct {
+	LogID  int64    `json:"logId"`
+	Weight *float64 `json:"weight"`
+	Date   string   `json:"date"`
+	Time   string   `json:"time"`
+}
+
+// ParseFitbit reads one of the weight-YYYY-MM-DD.json files from a Fitbit
+// data export:
+//
+//	[{"logId": 1672558200000, "weight": 176.4, "bmi": 24.6, "date": "01/01/23", "time": "07:30:00", "source": "Aria"}]
+//
+// Weights are in pounds and times are local, so they are taken in loc. Line
+// numbers count entries in the array.
+func ParseFitbit(r io.Reader, loc *time.Location) ([]Row, error) {
+	var entries []fitbitEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid Fitbit JSON: %w", err)
+	}
+
+	rows := make([]Row, 0, len(entries))
+	for i, entry := range entries {
+		row := Row{Line: i + 1}
+
+		recordedAt, err := time.ParseInLocation("01/02/06 15:04:05", entry.Date+" "+entry.Time, loc)
+		if err != nil {
+			row.Error = fmt.Sprintf("invalid date %q %q", entry.Date, entry.Time)
+			rows = append(rows, row)
+			continue
+		}
+		row.Weight.RecordedAt = recordedAt
+
+		if entry.Weight == nil {
+			row.Error = "missing weight"
+			rows = append(rows, row)
+			continue
+		}
+		row.Weight.WeightKg = models.ToKg(*entry.Weight, models.UnitLb)
+
+		row.Validate()
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
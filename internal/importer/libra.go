@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"weight-tracker/internal/models"
+)
+
+// ParseLibra reads a Libra CSV export:
+//
+//	#Version:6
+//	#Units:kg
+//
+//	#date;weight;weight trend;body fat;body fat trend;muscle mass;muscle mass trend;log
+//	2023-01-01T07:30:00.000Z;80.5;80.6;;;;;after run
+//
+// Timestamps carry their own offset. The unit comes from the #Units line and
+// the log column becomes the notes.
+func ParseLibra(r io.Reader, loc *time.Location) ([]Row, error) {
+	unit := models.UnitKg
+	var rows []Row
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\xef\xbb\xbf")
+		}
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "#") {
+			if v, ok := strings.CutPrefix(text, "#Units:"); ok {
+				if unit = unitInText(v); unit == "" {
+					return nil, fmt.Errorf("unknown unit %q", strings.TrimSpace(v))
+				}
+			}
+			continue
+		}
+
+		// The log may itself contain semicolons
+		fields := strings.SplitN(text, ";", 8)
+		row := Row{Line: line}
+		if len(fields) == 8 {
+			row.Weight.Notes = strings.TrimSpace(fields[7])
+		}
+
+		recordedAt, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(fields[0]))
+		if err != nil {
+			row.Error = fmt.Sprintf("invalid date %q", fields[0])
+			rows = append(rows, row)
+			continue
+		}
+		row.Weight.RecordedAt = recordedAt
+
+		if len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+			row.Error = "missing weight"
+			rows = append(rows, row)
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+		if err != nil {
+			row.Error = fmt.Sprintf("invalid weight %q", fields[1])
+			rows = append(rows, row)
+			continue
+		}
+		row.Weight.WeightKg = models.ToKg(value, unit)
+
+		row.Validate()
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
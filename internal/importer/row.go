@@ -0,0 +1,37 @@
+package importer
+
+import (
+	"fmt"
+	"weight-tracker/internal/models"
+)
+
+// Row is one reading found in an imported file. Error is set when it can't
+// be imported.
+type Row struct {
+	Source string        `json:"source,omitempty"` // File name, when several files are imported
+	Line   int           `json:"line"`
+	Weight models.Weight `json:"weight"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// Validate applies the same limits as entries logged by hand, setting Error
+// if the row breaks one. Rows that already have an error are left alone.
+func (r *Row) Validate() {
+	if r.Error != "" {
+		return
+	}
+
+	w := r.Weight
+	switch {
+	case w.RecordedAt.IsZero():
+		r.Error = "missing date"
+	case !(w.WeightKg >= models.MinWeightKg && w.WeightKg <= models.MaxWeightKg): // also catches NaN
+		r.Error = fmt.Sprintf("weight must be between %d and %d kg", models.MinWeightKg, models.MaxWeightKg)
+	case len(w.Notes) > models.MaxNotesLength:
+		r.Error = fmt.Sprintf("notes must be at most %d characters", models.MaxNotesLength)
+	default:
+		if err := models.ValidateRecordedAt(w.RecordedAt); err != nil {
+			r.Error = err.Error()
+		}
+	}
+}
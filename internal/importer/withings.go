@@ -0,0 +1,56 @@
+package importer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"weight-tracker/internal/models"
+)
+
+// ParseWithings reads the weight.csv file from a Withings data export:
+//
+//	Date,"Weight (kg)","Fat mass (kg)","Bone mass (kg)","Muscle mass (kg)","Hydration (kg)",Comments
+//	"2023-01-01 07:30:00",80.5,16.1,3.2,60.1,44.0,
+//
+// Times are local, so they are taken in loc. The unit comes from the weight
+// header.
+func ParseWithings(r io.Reader, loc *time.Location) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	file, err := Read(data)
+	if err != nil {
+		return nil, err
+	}
+
+	m := Mapping{
+		HasHeader:    true,
+		DateColumn:   NoColumn,
+		TimeColumn:   NoColumn,
+		WeightColumn: NoColumn,
+		NotesColumn:  NoColumn,
+		DateFormat:   "iso",
+		Unit:         models.UnitKg,
+	}
+	for col, name := range file.Records[0].Fields {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "Date":
+			m.DateColumn = col
+		case strings.HasPrefix(name, "Weight ("):
+			m.WeightColumn = col
+			if unit := unitInText(name); unit != "" {
+				m.Unit = unit
+			}
+		case name == "Comments":
+			m.NotesColumn = col
+		}
+	}
+	if m.DateColumn == NoColumn || m.WeightColumn == NoColumn {
+		return nil, errors.New("not a Withings weight export: missing Date or Weight column")
+	}
+
+	return file.Rows(m, loc), nil
+}
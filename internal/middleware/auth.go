@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"context"
+	"log"
 	"net/http"
+	"strings"
 	"weight-tracker/internal/models"
 )
 
@@ -12,50 +14,84 @@ const (
 	UserIDKey   contextKey = "user_id"
 	UserKey     contextKey = "user"
 	IsAuthKey   contextKey = "is_authenticated"
+	SessionKey  contextKey = "session"
+	APITokenKey contextKey = "api_token"
 )
 
-func AuthMiddleware(userRepo *models.UserRepository) func(http.Handler) http.Handler {
+// SessionCookieName is the cookie holding the opaque session token, before
+// any prefix Cookies adds.
+const SessionCookieName = "session_token"
+
+func AuthMiddleware(userRepo *models.UserRepository, sessionRepo *models.SessionRepository, apiTokenRepo *models.APITokenRepository, cookies Cookies) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Check for session cookie or token
-			cookie, err := r.Cookie("session_token")
-			if err != nil || cookie.Value == "" {
-				// User not authenticated
-				ctx := context.WithValue(r.Context(), IsAuthKey, false)
+			// Scripts and devices authenticate with a personal API token
+			if secret, ok := apiBearerToken(r); ok {
+				token, err := apiTokenRepo.GetByToken(secret)
+				if err != nil {
+					ctx := context.WithValue(r.Context(), IsAuthKey, false)
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+
+				if !token.CanWrite() && !isSafeMethod(r.Method) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusForbidden)
+					w.Write([]byte(`{"error":"token is read-only"}` + "\n"))
+					return
+				}
+
+				user, err := userRepo.GetByID(token.UserID)
+				if err != nil || user.IsScheduledForDeletion() {
+					ctx := context.WithValue(r.Context(), IsAuthKey, false)
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), IsAuthKey, true)
+				ctx = context.WithValue(ctx, UserIDKey, user.ID)
+				ctx = context.WithValue(ctx, UserKey, user)
+				ctx = context.WithValue(ctx, APITokenKey, token)
+
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
-			// Validate session token format (should be "user_" + username)
-			if len(cookie.Value) < 6 || cookie.Value[:5] != "user_" {
-				// Invalid session format
+			// Check for session cookie
+			sessionToken := cookies.Get(r, SessionCookieName)
+			if sessionToken == "" {
+				// User not authenticated
 				ctx := context.WithValue(r.Context(), IsAuthKey, false)
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
-			// Extract username from session token
-			username := cookie.Value[5:]
-			if username == "" {
-				// Invalid session - no username
+			// Look up the session on the server; unknown or expired tokens are ignored
+			session, err := sessionRepo.GetByToken(sessionToken)
+			if err != nil {
 				ctx := context.WithValue(r.Context(), IsAuthKey, false)
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
-			// Verify user exists in database
-			user, err := userRepo.GetByUsername(username)
-			if err != nil {
-				// User not found - invalid session
+			// Verify user still exists in database
+			user, err := userRepo.GetByID(session.UserID)
+			if err != nil || user.IsScheduledForDeletion() {
+				// User not found or disabled - invalid session
 				ctx := context.WithValue(r.Context(), IsAuthKey, false)
 				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
+			if err := sessionRepo.Touch(session); err != nil {
+				log.Printf("Failed to update session %d: %v", session.ID, err)
+			}
+
 			// User is authenticated - set context values
 			ctx := context.WithValue(r.Context(), IsAuthKey, true)
 			ctx = context.WithValue(ctx, UserIDKey, user.ID)
 			ctx = context.WithValue(ctx, UserKey, user)
+			ctx = context.WithValue(ctx, SessionKey, session)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -67,13 +103,41 @@ func RequireAuth(next http.Handler) http.Handler {
 		// Check if user is authenticated
 		authValue := r.Context().Value(IsAuthKey)
 		if authValue == nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			loginRequired(w, r)
 			return
 		}
 
 		isAuthenticated, ok := authValue.(bool)
 		if !ok || !isAuthenticated {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			loginRequired(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loginRequired sends the browser to the login page. Scripts that sent an API
+// token to a page outside the versioned API get a 401 instead, since tokens
+// are only accepted there.
+func loginRequired(w http.ResponseWriter, r *http.Request) {
+	if _, ok := bearerToken(r); ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":"API tokens are only accepted under /api/v1/"}` + "\n"))
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// RequireAPIAuth is RequireAuth for JSON endpoints: it answers with a 401 JSON
+// body instead of redirecting to the login page.
+func RequireAPIAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsAuthenticated(r) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"authentication required"}` + "\n"))
 			return
 		}
 
@@ -95,9 +159,49 @@ func GetUser(r *http.Request) *models.User {
 	return nil
 }
 
+func GetSession(r *http.Request) *models.Session {
+	if session, ok := r.Context().Value(SessionKey).(*models.Session); ok {
+		return session
+	}
+	return nil
+}
+
+func GetAPIToken(r *http.Request) *models.APIToken {
+	if token, ok := r.Context().Value(APITokenKey).(*models.APIToken); ok {
+		return token
+	}
+	return nil
+}
+
 func IsAuthenticated(r *http.Request) bool {
 	if isAuth, ok := r.Context().Value(IsAuthKey).(bool); ok {
 		return isAuth
 	}
 	return false
-}
\ No newline at end of file
+}
+
+// apiBearerToken returns the Bearer token of a request to the versioned API.
+// Everywhere else the header is ignored, so a token can't reach the account
+// pages to mint further tokens or change the password. The API's own archive
+// export checks for a read-write token itself.
+func apiBearerToken(r *http.Request) (string, bool) {
+	if !strings.HasPrefix(r.URL.Path, "/api/v1/") {
+		return "", false
+	}
+	return bearerToken(r)
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(auth[7:])
+	return token, token != ""
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
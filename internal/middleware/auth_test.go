@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"weight-tracker/internal/models"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestDB returns a fresh database with every migration applied. The
+// config package opens the server's database, but it imports this one.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db")+"?_time_format=sqlite&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob("../../migrations/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("find migrations: %v", err)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		if _, err := db.Exec(string(content)); err != nil {
+			t.Fatalf("apply %s: %v", file, err)
+		}
+	}
+	return db
+}
+
+func TestAuthMiddlewareSessionCookie(t *testing.T) {
+	db := newTestDB(t)
+	sessions := models.NewSessionRepository(db)
+
+	user, err := models.NewUserRepository(db).Create("alice", "password123")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	valid, err := sessions.Create(user.ID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	expired, err := sessions.Create(user.ID, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	idleSince := time.Now().UTC().Add(-models.SessionIdleTimeout - time.Minute)
+	if _, err := db.Exec(`UPDATE sessions SET last_seen_at = ? WHERE id = ?`, idleSince, expired.ID); err != nil {
+		t.Fatalf("age session: %v", err)
+	}
+
+	var gotUserID int
+	var gotAuth bool
+	handler := AuthMiddleware(models.NewUserRepository(db), sessions, models.NewAPITokenRepository(db), Cookies{})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotUserID = GetUserID(r)
+			gotAuth = IsAuthenticated(r)
+		}))
+
+	tests := []struct {
+		name   string
+		cookie string
+		want   bool
+	}{
+		{"no cookie", "", false},
+		{"unknown session", "not-a-session", false},
+		{"expired session", expired.Token, false},
+		{"valid session", valid.Token, true},
+	}
+	for _, tt := range tests {
+		gotUserID, gotAuth = 0, false
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: tt.cookie})
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if gotAuth != tt.want || (gotUserID == user.ID) != tt.want {
+			t.Errorf("%s: authenticated = %v as user %d, want %v", tt.name, gotAuth, gotUserID, tt.want)
+		}
+	}
+
+	// Ignoring the expired cookie also removed its session
+	if _, err := sessions.GetByToken(expired.Token); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expired session lookup: err = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// Cookies decides how the app's cookies are named and flagged. Every cookie
+// is HttpOnly, scoped to the whole site and SameSite=Lax.
+type Cookies struct {
+	// Secure sends cookies over HTTPS only and gives them the __Host-
+	// prefix, so browsers refuse copies set over plain HTTP or by another
+	// subdomain.
+	Secure bool
+}
+
+// Name returns the name the cookie is stored under.
+func (c Cookies) Name(name string) string {
+	if c.Secure {
+		return "__Host-" + name
+	}
+	return name
+}
+
+// Get returns the value of the named cookie, or "" if the request has none.
+func (c Cookies) Get(r *http.Request, name string) string {
+	cookie, err := r.Cookie(c.Name(name))
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// Set sets the named cookie. A zero expiry makes it last until the browser
+// is closed.
+func (c Cookies) Set(w http.ResponseWriter, name, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.Name(name),
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   c.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Clear tells the browser to drop the named cookie.
+func (c Cookies) Clear(w http.ResponseWriter, name string) {
+	c.Set(w, name, "", time.Now().Add(-1*time.Hour))
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// CSRFFieldName is the form field that carries the CSRF token. In
+	// multipart forms it must be the first field.
+	CSRFFieldName = "csrf_token"
+	// CSRFHeaderName is the header HTMX requests carry the token in.
+	CSRFHeaderName = "X-CSRF-Token"
+	// CSRFCookieName holds the secret for visitors who aren't signed in.
+	CSRFCookieName = "csrf_token"
+
+	CSRFTokenKey contextKey = "csrf_token"
+)
+
+// CSRF rejects unsafe requests that don't carry the token for the browser's
+// session. The token is derived from the session cookie, so it changes on
+// every login and needs no storage; before login a random cookie stands in
+// for the session. API requests with a Bearer token are exempt, since
+// browsers never add that header on their own.
+func CSRF(cookies Cookies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := apiBearerToken(r); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			secret := csrfSecret(w, r, cookies)
+			if secret == "" {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			token := csrfToken(secret)
+
+			if !isSafeMethod(r.Method) {
+				sent := requestCSRFToken(r)
+				if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+					csrfFailure(w, r)
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), CSRFTokenKey, token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// CSRFToken returns the token pages must include in unsafe requests.
+func CSRFToken(r *http.Request) string {
+	if token, ok := r.Context().Value(CSRFTokenKey).(string); ok {
+		return token
+	}
+	return ""
+}
+
+// csrfSecret returns the session token, or else the visitor's CSRF cookie,
+// issuing one if there is none yet.
+func csrfSecret(w http.ResponseWriter, r *http.Request, cookies Cookies) string {
+	if secret := cookies.Get(r, SessionCookieName); secret != "" {
+		return secret
+	}
+	if secret := cookies.Get(r, CSRFCookieName); secret != "" {
+		return secret
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	cookies.Set(w, CSRFCookieName, secret, time.Time{})
+	return secret
+}
+
+// csrfToken derives the token from the secret. The secret itself never
+// appears in pages.
+func csrfToken(secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("csrf"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// requestCSRFToken finds the token in the header or the form. Multipart
+// bodies are only read as far as the first field and then put back, so
+// upload handlers still apply their own size limits.
+func requestCSRFToken(r *http.Request) string {
+	if token := r.Header.Get(CSRFHeaderName); token != "" {
+		return token
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		return r.PostFormValue(CSRFFieldName)
+	case "multipart/form-data":
+		var consumed bytes.Buffer
+		part, err := multipart.NewReader(io.TeeReader(r.Body, &consumed), params["boundary"]).NextPart()
+		token := ""
+		if err == nil && part.FormName() == CSRFFieldName {
+			value, _ := io.ReadAll(io.LimitReader(part, 256))
+			token = string(value)
+		}
+		r.Body = replayedBody{io.MultiReader(&consumed, r.Body), r.Body}
+		return token
+	}
+	return ""
+}
+
+// replayedBody reads back the bytes already consumed before the rest of the
+// original body.
+type replayedBody struct {
+	io.Reader
+	io.Closer
+}
+
+func csrfFailure(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":"invalid or missing CSRF token"}` + "\n"))
+		return
+	}
+	http.Error(w, "Invalid or missing CSRF token. Reload the page and try again.", http.StatusForbidden)
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// csrfEcho answers with the uploaded file's contents, or "ok".
+var csrfEcho = CSRF(Cookies{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if r.FormValue(CSRFFieldName) == "" {
+			http.Error(w, "token missing from replayed body", http.StatusBadRequest)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(file)
+		w.Write(buf.Bytes())
+		return
+	}
+	w.Write([]byte("ok"))
+}))
+
+// csrfVisit makes a GET as a new visitor and returns its cookie and token.
+func csrfVisit(t *testing.T) (*http.Cookie, string) {
+	t.Helper()
+
+	var token string
+	handler := CSRF(Cookies{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = CSRFToken(r)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CSRFCookieName {
+		t.Fatalf("cookies = %v, want a %s cookie", cookies, CSRFCookieName)
+	}
+	if token == "" || token == cookies[0].Value {
+		t.Fatalf("token %q should be derived from, not equal to, the cookie", token)
+	}
+	return cookies[0], token
+}
+
+func TestCSRFForm(t *testing.T) {
+	cookie, token := csrfVisit(t)
+
+	tests := []struct {
+		name   string
+		token  string
+		cookie *http.Cookie
+		want   int
+	}{
+		{"valid", token, cookie, http.StatusOK},
+		{"missing token", "", cookie, http.StatusForbidden},
+		{"wrong token", token + "x", cookie, http.StatusForbidden},
+		{"no cookie", token, nil, http.StatusForbidden},
+		{"another session", token, &http.Cookie{Name: SessionCookieName, Value: "other"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{"username": {"alice"}}
+		if tt.token != "" {
+			form.Set(CSRFFieldName, tt.token)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.cookie != nil {
+			req.AddCookie(tt.cookie)
+		}
+
+		rec := httptest.NewRecorder()
+		csrfEcho.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestCSRFHeaderAndBearer(t *testing.T) {
+	session := &http.Cookie{Name: SessionCookieName, Value: "session-token"}
+
+	req := httptest.NewRequest(http.MethodDelete, "/weights?id=1", nil)
+	req.AddCookie(session)
+	req.Header.Set(CSRFHeaderName, csrfToken(session.Value))
+	rec := httptest.NewRecorder()
+	csrfEcho.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("header token: status = %d, want 200", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/weights/1", nil)
+	req.AddCookie(session)
+	rec = httptest.NewRecorder()
+	csrfEcho.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"error"`) {
+		t.Errorf("API without token: status = %d, body %q; want a 403 JSON error", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/weights/1", nil)
+	req.Header.Set("Authorization", "Bearer wt_secret")
+	rec = httptest.NewRecorder()
+	csrfEcho.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("bearer token: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestCSRFMultipart(t *testing.T) {
+	cookie, token := csrfVisit(t)
+	// Larger than the multipart reader's buffer, so the body is only
+	// partly read when the token is checked
+	contents := strings.Repeat("2024-01-02,80.5\n", 1000)
+
+	upload := func(fields ...string) *httptest.ResponseRecorder {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		for i := 0; i < len(fields); i += 2 {
+			mw.WriteField(fields[i], fields[i+1])
+		}
+		fw, _ := mw.CreateFormFile("file", "weights.csv")
+		fw.Write([]byte(contents))
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/import", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		csrfEcho.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := upload(CSRFFieldName, token, "step", "preview")
+	if rec.Code != http.StatusOK || rec.Body.String() != contents {
+		t.Errorf("valid upload: status = %d, body intact = %v", rec.Code, rec.Body.String() == contents)
+	}
+
+	// The token has to come first
+	if rec := upload("step", "preview", CSRFFieldName, token); rec.Code != http.StatusForbidden {
+		t.Errorf("token after another field: status = %d, want 403", rec.Code)
+	}
+	if rec := upload(CSRFFieldName, "wrong"); rec.Code != http.StatusForbidden {
+		t.Errorf("wrong token: status = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	ClientIPKey contextKey = "client_ip"
+	SecureKey   contextKey = "secure"
+)
+
+// ClientIP returns the IP address of the client that sent the request. Behind
+// a trusted proxy this is the address the proxy reported; see TrustProxies.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIPKey).(string); ok {
+		return ip
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// IsSecure reports whether the client reached the server over HTTPS, either
+// directly or through a trusted proxy.
+func IsSecure(r *http.Request) bool {
+	if secure, ok := r.Context().Value(SecureKey).(bool); ok {
+		return secure
+	}
+	return r.TLS != nil
+}
+
+// TrustProxies takes the client's address and scheme from X-Forwarded-For and
+// X-Forwarded-Proto when the request comes from one of the trusted proxies.
+// The headers are ignored from anyone else, since clients can send them too.
+func TrustProxies(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trusted {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, err := netip.ParseAddrPort(r.RemoteAddr)
+			if len(trusted) == 0 || err != nil || !isTrusted(peer.Addr()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			if ip, ok := forwardedFor(r, isTrusted); ok {
+				ctx = context.WithValue(ctx, ClientIPKey, ip)
+			}
+			if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+				proto, _, _ = strings.Cut(proto, ",")
+				ctx = context.WithValue(ctx, SecureKey, strings.EqualFold(strings.TrimSpace(proto), "https"))
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// forwardedFor returns the client address from X-Forwarded-For: the last
+// hop that isn't itself a trusted proxy. Earlier entries were written by the
+// client and can't be believed.
+func forwardedFor(r *http.Request, isTrusted func(netip.Addr) bool) (string, bool) {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !isTrusted(client) {
+			break
+		}
+	}
+
+	if !client.IsValid() {
+		return "", false
+	}
+	return client.String(), true
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestTrustProxies(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		proto      string
+		wantIP     string
+		wantSecure bool
+	}{
+		{"direct", "203.0.113.7:5000", "", "", "203.0.113.7", false},
+		{"untrusted peer", "203.0.113.7:5000", "198.51.100.1", "https", "203.0.113.7", false},
+		{"trusted proxy", "10.0.0.2:5000", "198.51.100.1", "https", "198.51.100.1", true},
+		{"plain HTTP through proxy", "10.0.0.2:5000", "198.51.100.1", "http", "198.51.100.1", false},
+		{"spoofed first hop", "10.0.0.2:5000", "1.2.3.4, 198.51.100.1", "https", "198.51.100.1", true},
+		{"proxy chain", "10.0.0.2:5000", "198.51.100.1, 10.0.0.3", "https", "198.51.100.1", true},
+		{"IPv6 proxy", "[::1]:5000", "2001:db8::1", "https", "2001:db8::1", true},
+		{"no header", "10.0.0.2:5000", "", "", "10.0.0.2", false},
+	}
+
+	for _, tt := range tests {
+		var gotIP string
+		var gotSecure bool
+		handler := TrustProxies(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotIP, gotSecure = ClientIP(r), IsSecure(r)
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if tt.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if gotIP != tt.wantIP || gotSecure != tt.wantSecure {
+			t.Errorf("%s: got %s secure=%t, want %s secure=%t", tt.name, gotIP, gotSecure, tt.wantIP, tt.wantSecure)
+		}
+	}
+}
+
+func TestSecureCookies(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Cookies{Secure: true}.Set(rec, SessionCookieName, "token", time.Time{})
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	c := cookies[0]
+	if c.Name != "__Host-"+SessionCookieName || !c.Secure || c.Path != "/" || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie = %+v, want a secure __Host- cookie", c)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "planted"})
+	if got := (Cookies{Secure: true}).Get(req, SessionCookieName); got != "" {
+		t.Errorf("unprefixed cookie was read as the session: %q", got)
+	}
+}
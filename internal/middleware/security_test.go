@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeadersNonce(t *testing.T) {
+	var nonce string
+	handler := SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = CSPNonce(r)
+	}))
+
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		csp := rec.Header().Get("Content-Security-Policy")
+		if nonce == "" || !strings.Contains(csp, "script-src 'nonce-"+nonce+"'") {
+			t.Errorf("CSP %q doesn't allow nonce %q", csp, nonce)
+		}
+		if strings.Contains(csp, "unsafe-inline") {
+			t.Errorf("CSP allows unsafe-inline: %q", csp)
+		}
+		if seen[nonce] {
+			t.Errorf("nonce %q reused", nonce)
+		}
+		seen[nonce] = true
+	}
+}
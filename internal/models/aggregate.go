@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// AggregateDaily collapses the readings of each day, as seen in loc, into one
+// value using the given aggregation. weights must be sorted by RecordedAt
+// (either direction); the result keeps that order. Each returned entry is a
+// copy of the day's chronologically first reading with WeightKg replaced by
+// the aggregate.
+func AggregateDaily(weights []Weight, aggregation string, loc *time.Location) []Weight {
+	var result []Weight
+
+	for start := 0; start < len(weights); {
+		day := dayKey(weights[start].RecordedAt, loc)
+		end := start + 1
+		for end < len(weights) && dayKey(weights[end].RecordedAt, loc) == day {
+			end++
+		}
+
+		result = append(result, aggregateDay(weights[start:end], aggregation))
+		start = end
+	}
+
+	return result
+}
+
+func aggregateDay(readings []Weight, aggregation string) Weight {
+	first, last := readings[0], readings[0]
+	min, sum := readings[0].WeightKg, 0.0
+	for _, w := range readings {
+		if w.RecordedAt.Before(first.RecordedAt) {
+			first = w
+		}
+		if !w.RecordedAt.Before(last.RecordedAt) {
+			last = w
+		}
+		if w.WeightKg < min {
+			min = w.WeightKg
+		}
+		sum += w.WeightKg
+	}
+
+	day := first
+	switch aggregation {
+	case AggregateFirst:
+		day.WeightKg = first.WeightKg
+	case AggregateMin:
+		day.WeightKg = min
+	case AggregateMean:
+		day.WeightKg = sum / float64(len(readings))
+	default:
+		day.WeightKg = last.WeightKg
+	}
+	return day
+}
+
+func dayKey(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// StartOfDay returns midnight at the start of t's day in t's location.
+func StartOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// ScopeRead tokens may only read data.
+	ScopeRead = "read"
+	// ScopeReadWrite tokens may also create, change and delete data.
+	ScopeReadWrite = "read_write"
+
+	// APITokenPrefix marks secrets issued by this app so they are easy to
+	// recognise in scripts and secret scanners.
+	APITokenPrefix = "wt_"
+
+	// apiTokenTouchInterval limits how often last_used_at is written back.
+	apiTokenTouchInterval = time.Minute
+)
+
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Token      string     `json:"-"` // Only populated when the token is created
+	Prefix     string     `json:"prefix"`
+	Scope      string     `json:"scope"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// CanWrite reports whether the token may be used for state-changing requests.
+func (t *APIToken) CanWrite() bool {
+	return t.Scope == ScopeReadWrite
+}
+
+type APITokenRepository struct {
+	db *sql.DB
+}
+
+func NewAPITokenRepository(db *sql.DB) *APITokenRepository {
+	return &APITokenRepository{db: db}
+}
+
+// Create issues a new token. The returned APIToken carries the secret in
+// Token; only its hash is stored, so it can't be shown again.
+func (r *APITokenRepository) Create(userID int, name, scope string) (*APIToken, error) {
+	if name == "" {
+		return nil, fmt.Errorf("token name cannot be empty")
+	}
+	if len(name) > 100 {
+		return nil, fmt.Errorf("token name must be at most 100 characters")
+	}
+	if scope != ScopeRead && scope != ScopeReadWrite {
+		return nil, fmt.Errorf("invalid token scope %q", scope)
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API token: %w", err)
+	}
+
+	token := &APIToken{
+		UserID:    userID,
+		Name:      name,
+		Token:     APITokenPrefix + secret,
+		Scope:     scope,
+		CreatedAt: time.Now().UTC(),
+	}
+	token.Prefix = token.Token[:len(APITokenPrefix)+6]
+
+	query := `INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scope, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := r.db.Exec(query, token.UserID, token.Name, hashToken(token.Token), token.Prefix,
+		token.Scope, token.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API token: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API token ID: %w", err)
+	}
+
+	token.ID = int(id)
+	return token, nil
+}
+
+// GetByToken looks up a token by its secret and records that it was used.
+func (r *APITokenRepository) GetByToken(secret string) (*APIToken, error) {
+	query := `SELECT id, user_id, name, token_prefix, scope, created_at, last_used_at
+              FROM api_tokens WHERE token_hash = ?`
+	row := r.db.QueryRow(query, hashToken(secret))
+
+	token, err := scanAPIToken(row)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+		if _, err := r.db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now, token.ID); err != nil {
+			return nil, err
+		}
+		token.LastUsedAt = &now
+	}
+
+	return token, nil
+}
+
+func (r *APITokenRepository) ListByUser(userID int) ([]APIToken, error) {
+	query := `SELECT id, user_id, name, token_prefix, scope, created_at, last_used_at
+              FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (r *APITokenRepository) Delete(id, userID int) error {
+	query := `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`
+	result, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	var token APIToken
+	var lastUsed sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.Scope,
+		&token.CreatedAt, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastUsed.Valid {
+		token.LastUsedAt = &lastUsed.Time
+	}
+	return &token, nil
+}
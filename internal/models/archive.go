@@ -0,0 +1,263 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ArchiveFormat identifies an account archive and ArchiveVersion is the schema
+// version this build writes. Archives from older versions are still read;
+// newer ones are refused. The schema is documented in README.md.
+const (
+	ArchiveFormat  = "weight-tracker-archive"
+	ArchiveVersion = 1
+)
+
+// ErrAccountNotEmpty is returned when restoring into an account that already
+// has weights or goals.
+var ErrAccountNotEmpty = errors.New("account already has data")
+
+// Archive is a portable copy of everything a user has stored. Row IDs are
+// left out so it can be restored on another server. Sessions and API tokens
+// are credentials for this server only and are not included.
+type Archive struct {
+	Format     string          `json:"format"`
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Profile    ArchiveProfile  `json:"profile"`
+	Settings   Settings        `json:"settings"`
+	Weights    []ArchiveWeight `json:"weights"`
+	Goals      []ArchiveGoal   `json:"goals"`
+}
+
+// ArchiveProfile describes the account the archive was taken from. It is not
+// restored: the account it is imported into keeps its own name and password.
+type ArchiveProfile struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ArchiveWeight struct {
+	WeightKg   float64   `json:"weight_kg"`
+	RecordedAt time.Time `json:"recorded_at"`
+	Notes      string    `json:"notes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type ArchiveGoal struct {
+	StartWeightKg  float64    `json:"start_weight_kg"`
+	TargetWeightKg float64    `json:"target_weight_kg"`
+	TargetDate     *time.Time `json:"target_date"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ClosedAt       *time.Time `json:"closed_at"`
+}
+
+// Validate checks that the archive is one this build can restore and that
+// every record in it would be accepted if entered by hand.
+func (a *Archive) Validate() error {
+	if a.Format != ArchiveFormat {
+		return fmt.Errorf("not a weight tracker archive")
+	}
+	if a.Version < 1 || a.Version > ArchiveVersion {
+		return fmt.Errorf("unsupported archive version %d", a.Version)
+	}
+	if err := a.Settings.Validate(); err != nil {
+		return fmt.Errorf("settings: %w", err)
+	}
+
+	for i, weight := range a.Weights {
+		if weight.WeightKg < MinWeightKg || weight.WeightKg > MaxWeightKg {
+			return fmt.Errorf("weight %d: weight must be between %d and %d kg", i+1, MinWeightKg, MaxWeightKg)
+		}
+		if weight.RecordedAt.IsZero() {
+			return fmt.Errorf("weight %d: missing recorded_at", i+1)
+		}
+		if err := ValidateRecordedAt(weight.RecordedAt); err != nil {
+			return fmt.Errorf("weight %d: %w", i+1, err)
+		}
+		if len(weight.Notes) > MaxNotesLength {
+			return fmt.Errorf("weight %d: notes must be at most %d characters", i+1, MaxNotesLength)
+		}
+	}
+
+	open := 0
+	for i, goal := range a.Goals {
+		for _, kg := range []float64{goal.StartWeightKg, goal.TargetWeightKg} {
+			if kg < MinWeightKg || kg > MaxWeightKg {
+				return fmt.Errorf("goal %d: weight must be between %d and %d kg", i+1, MinWeightKg, MaxWeightKg)
+			}
+		}
+		if goal.CreatedAt.IsZero() {
+			return fmt.Errorf("goal %d: missing created_at", i+1)
+		}
+		if goal.ClosedAt == nil {
+			open++
+		}
+	}
+	if open > 1 {
+		return fmt.Errorf("more than one active goal")
+	}
+
+	return nil
+}
+
+// ArchiveRepository reads and restores whole accounts through the per-table
+// repositories.
+type ArchiveRepository struct {
+	db           *sql.DB
+	userRepo     *UserRepository
+	weightRepo   *WeightRepository
+	settingsRepo *SettingsRepository
+	goalRepo     *GoalRepository
+}
+
+func NewArchiveRepository(db *sql.DB) *ArchiveRepository {
+	return &ArchiveRepository{
+		db:           db,
+		userRepo:     NewUserRepository(db),
+		weightRepo:   NewWeightRepository(db),
+		settingsRepo: NewSettingsRepository(db),
+		goalRepo:     NewGoalRepository(db),
+	}
+}
+
+// Export collects the user's data into an archive. Weights and goals are
+// listed oldest first.
+func (r *ArchiveRepository) Export(userID int) (*Archive, error) {
+	user, err := r.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := r.settingsRepo.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &Archive{
+		Format:     ArchiveFormat,
+		Version:    ArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		Profile: ArchiveProfile{
+			Username:  user.Username,
+			CreatedAt: user.CreatedAt.UTC(),
+		},
+		Settings: *settings,
+		Weights:  []ArchiveWeight{},
+		Goals:    []ArchiveGoal{},
+	}
+
+	err = r.weightRepo.Each(userID, time.Time{}, time.Time{}, func(weight Weight) error {
+		archive.Weights = append(archive.Weights, ArchiveWeight{
+			WeightKg:   weight.WeightKg,
+			RecordedAt: weight.RecordedAt.UTC(),
+			Notes:      weight.Notes,
+			CreatedAt:  weight.CreatedAt.UTC(),
+			UpdatedAt:  weight.UpdatedAt.UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	goals, err := r.goalRepo.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(goals) - 1; i >= 0; i-- {
+		goal := goals[i]
+		archive.Goals = append(archive.Goals, ArchiveGoal{
+			StartWeightKg:  goal.StartWeightKg,
+			TargetWeightKg: goal.TargetWeightKg,
+			TargetDate:     utcOrNil(goal.TargetDate),
+			CreatedAt:      goal.CreatedAt.UTC(),
+			ClosedAt:       utcOrNil(goal.ClosedAt),
+		})
+	}
+
+	return archive, nil
+}
+
+// Restore loads an archive into the user's account in a single transaction.
+// It only restores into an account without weights or goals, so an archive
+// can't be merged into existing history by accident; otherwise it returns
+// ErrAccountNotEmpty. Settings replace the account's current ones.
+func (r *ArchiveRepository) Restore(userID int, archive *Archive) error {
+	if err := archive.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var existing int
+	err = tx.QueryRow(`SELECT (SELECT COUNT(*) FROM weights WHERE user_id = ?) +
+                              (SELECT COUNT(*) FROM goals WHERE user_id = ?)`, userID, userID).Scan(&existing)
+	if err != nil {
+		return err
+	}
+	if existing > 0 {
+		return ErrAccountNotEmpty
+	}
+
+	query := `INSERT INTO settings (user_id, key, value) VALUES (?, ?, ?)
+              ON CONFLICT(user_id, key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`
+	for key, value := range archive.Settings.values() {
+		if _, err := tx.Exec(query, userID, key, value); err != nil {
+			return fmt.Errorf("failed to restore setting %s: %w", key, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	for i, weight := range archive.Weights {
+		createdAt := timeOr(weight.CreatedAt, now)
+		_, err := tx.Exec(`INSERT INTO weights (user_id, weight_kg, recorded_at, notes, created_at, updated_at)
+                           VALUES (?, ?, ?, ?, ?, ?)`,
+			userID, weight.WeightKg, weight.RecordedAt.UTC(), weight.Notes,
+			createdAt, timeOr(weight.UpdatedAt, createdAt))
+		if err != nil {
+			return fmt.Errorf("failed to restore weight %d: %w", i+1, err)
+		}
+	}
+
+	for i, goal := range archive.Goals {
+		var targetDate, closedAt interface{}
+		if goal.TargetDate != nil {
+			targetDate = goal.TargetDate.UTC()
+		}
+		if goal.ClosedAt != nil {
+			closedAt = goal.ClosedAt.UTC()
+		}
+		_, err := tx.Exec(`INSERT INTO goals (user_id, start_weight_kg, target_weight_kg, target_date, created_at, closed_at)
+                           VALUES (?, ?, ?, ?, ?, ?)`,
+			userID, goal.StartWeightKg, goal.TargetWeightKg, targetDate, goal.CreatedAt.UTC(), closedAt)
+		if err != nil {
+			return fmt.Errorf("failed to restore goal %d: %w", i+1, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func utcOrNil(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// timeOr returns t in UTC, or fallback when t is unset.
+func timeOr(t, fallback time.Time) time.Time {
+	if t.IsZero() {
+		return fallback
+	}
+	return t.UTC()
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustCreateUser(t *testing.T, repo *UserRepository, username string) *User {
+	t.Helper()
+
+	user, err := repo.Create(username, "password123")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	source := newTestDB(t)
+	alice := mustCreateUser(t, NewUserRepository(source), "alice")
+
+	settings := &Settings{
+		EntryMode:        EntryModeMultiple,
+		DailyAggregation: AggregateMean,
+		Timezone:         "Asia/Tokyo",
+		Unit:             UnitLb,
+	}
+	if err := NewSettingsRepository(source).Save(alice.ID, settings); err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+
+	weights := NewWeightRepository(source)
+	first := time.Date(2024, 1, 2, 7, 30, 0, 0, time.UTC)
+	mustCreateWeight(t, weights, alice.ID, 82.4, first)
+	second := &Weight{UserID: alice.ID, WeightKg: 81.9, RecordedAt: first.AddDate(0, 0, 1), Notes: "after run"}
+	if err := weights.Create(second); err != nil {
+		t.Fatalf("create weight: %v", err)
+	}
+
+	goals := NewGoalRepository(source)
+	targetDate := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, goal := range []*Goal{
+		{UserID: alice.ID, StartWeightKg: 82.4, TargetWeightKg: 78},
+		{UserID: alice.ID, StartWeightKg: 81.9, TargetWeightKg: 75, TargetDate: &targetDate},
+	} {
+		if err := goals.Create(goal); err != nil {
+			t.Fatalf("create goal: %v", err)
+		}
+	}
+
+	archive, err := NewArchiveRepository(source).Export(alice.ID)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if archive.Profile.Username != "alice" || archive.Version != ArchiveVersion {
+		t.Fatalf("unexpected archive header: %+v", archive)
+	}
+
+	// Restore into a fresh account on another database, via JSON
+	encoded, err := json.Marshal(archive)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded Archive
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	target := newTestDB(t)
+	bob := mustCreateUser(t, NewUserRepository(target), "bob")
+	if err := NewArchiveRepository(target).Restore(bob.ID, &decoded); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	restored, err := NewArchiveRepository(target).Export(bob.ID)
+	if err != nil {
+		t.Fatalf("export restored: %v", err)
+	}
+
+	if restored.Settings != *settings {
+		t.Errorf("settings = %+v, want %+v", restored.Settings, *settings)
+	}
+
+	if len(restored.Weights) != len(archive.Weights) {
+		t.Fatalf("restored %d weights, want %d", len(restored.Weights), len(archive.Weights))
+	}
+	for i, got := range restored.Weights {
+		want := archive.Weights[i]
+		if got.WeightKg != want.WeightKg || !got.RecordedAt.Equal(want.RecordedAt) ||
+			got.Notes != want.Notes || !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("weight %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	if len(restored.Goals) != 2 {
+		t.Fatalf("restored %d goals, want 2", len(restored.Goals))
+	}
+	if restored.Goals[0].ClosedAt == nil || restored.Goals[1].ClosedAt != nil {
+		t.Errorf("only the newest goal should be active: %+v", restored.Goals)
+	}
+	if restored.Goals[1].TargetDate == nil || !restored.Goals[1].TargetDate.Equal(targetDate) {
+		t.Errorf("target date = %v, want %v", restored.Goals[1].TargetDate, targetDate)
+	}
+}
+
+func TestArchiveRestoreRefusesAccountWithData(t *testing.T) {
+	db := newTestDB(t)
+	user := mustCreateUser(t, NewUserRepository(db), "carol")
+	mustCreateWeight(t, NewWeightRepository(db), user.ID, 70, time.Now().AddDate(0, 0, -1))
+
+	archive := &Archive{
+		Format:   ArchiveFormat,
+		Version:  ArchiveVersion,
+		Settings: *DefaultSettings(),
+		Weights:  []ArchiveWeight{{WeightKg: 71, RecordedAt: time.Now().AddDate(0, 0, -2)}},
+	}
+
+	err := NewArchiveRepository(db).Restore(user.ID, archive)
+	if !errors.Is(err, ErrAccountNotEmpty) {
+		t.Fatalf("restore error = %v, want ErrAccountNotEmpty", err)
+	}
+
+	count, err := NewWeightRepository(db).Count(user.ID)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("account has %d weights after refused restore, want 1", count)
+	}
+}
+
+func TestArchiveValidate(t *testing.T) {
+	valid := func() *Archive {
+		return &Archive{Format: ArchiveFormat, Version: ArchiveVersion, Settings: *DefaultSettings()}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Archive)
+	}{
+		{"wrong format", func(a *Archive) { a.Format = "something-else" }},
+		{"newer version", func(a *Archive) { a.Version = ArchiveVersion + 1 }},
+		{"bad setting", func(a *Archive) { a.Settings.Unit = "oz" }},
+		{"weight out of range", func(a *Archive) {
+			a.Weights = []ArchiveWeight{{WeightKg: 5, RecordedAt: time.Now().AddDate(0, 0, -1)}}
+		}},
+		{"future weight", func(a *Archive) {
+			a.Weights = []ArchiveWeight{{WeightKg: 70, RecordedAt: time.Now().AddDate(0, 0, 1)}}
+		}},
+		{"two active goals", func(a *Archive) {
+			goal := ArchiveGoal{StartWeightKg: 80, TargetWeightKg: 75, CreatedAt: time.Now()}
+			a.Goals = []ArchiveGoal{goal, goal}
+		}},
+	}
+
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("valid archive rejected: %v", err)
+	}
+	for _, tt := range tests {
+		archive := valid()
+		tt.modify(archive)
+		if err := archive.Validate(); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
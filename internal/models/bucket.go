@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Chart buckets
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// ValidBucket reports whether bucket is a supported bucket size.
+func ValidBucket(bucket string) bool {
+	switch bucket {
+	case BucketDay, BucketWeek, BucketMonth:
+		return true
+	}
+	return false
+}
+
+// WeightBucket summarises the readings of one day, week or month.
+type WeightBucket struct {
+	Start  time.Time
+	End    time.Time
+	MinKg  float64
+	MaxKg  float64
+	MeanKg float64
+	Count  int
+}
+
+// BucketStart returns the start of the bucket containing t, in t's location.
+// Weeks start on Monday.
+func BucketStart(t time.Time, bucket string) time.Time {
+	day := StartOfDay(t)
+	switch bucket {
+	case BucketWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case BucketMonth:
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day
+}
+
+// NextBucket returns the start of the bucket after the one starting at start.
+func NextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case BucketMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// BucketWeights groups readings into buckets as seen in loc. weights must be
+// in ascending order; empty buckets are left out.
+func BucketWeights(weights []Weight, bucket string, loc *time.Location) []WeightBucket {
+	var buckets []WeightBucket
+
+	for _, w := range weights {
+		start := BucketStart(w.RecordedAt.In(loc), bucket)
+		if n := len(buckets); n > 0 && buckets[n-1].Start.Equal(start) {
+			b := &buckets[n-1]
+			if w.WeightKg < b.MinKg {
+				b.MinKg = w.WeightKg
+			}
+			if w.WeightKg > b.MaxKg {
+				b.MaxKg = w.WeightKg
+			}
+			b.MeanKg += (w.WeightKg - b.MeanKg) / float64(b.Count+1)
+			b.Count++
+			continue
+		}
+
+		buckets = append(buckets, WeightBucket{
+			Start:  start,
+			End:    NextBucket(start, bucket),
+			MinKg:  w.WeightKg,
+			MaxKg:  w.WeightKg,
+			MeanKg: w.WeightKg,
+			Count:  1,
+		})
+	}
+
+	return buckets
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	loc := mustLoadLocation(t, "Europe/Berlin")
+	// Sunday evening, the day clocks went forward
+	at := time.Date(2024, 3, 31, 22, 30, 0, 0, loc)
+
+	tests := []struct {
+		bucket string
+		start  time.Time
+		next   time.Time
+	}{
+		{BucketDay, time.Date(2024, 3, 31, 0, 0, 0, 0, loc), time.Date(2024, 4, 1, 0, 0, 0, 0, loc)},
+		{BucketWeek, time.Date(2024, 3, 25, 0, 0, 0, 0, loc), time.Date(2024, 4, 1, 0, 0, 0, 0, loc)},
+		{BucketMonth, time.Date(2024, 3, 1, 0, 0, 0, 0, loc), time.Date(2024, 4, 1, 0, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		start := BucketStart(at, tt.bucket)
+		if !start.Equal(tt.start) {
+			t.Errorf("BucketStart(%s) = %v, want %v", tt.bucket, start, tt.start)
+		}
+		if next := NextBucket(start, tt.bucket); !next.Equal(tt.next) {
+			t.Errorf("NextBucket(%s) = %v, want %v", tt.bucket, next, tt.next)
+		}
+	}
+
+	// Monday starts its own week
+	monday := time.Date(2024, 4, 1, 6, 0, 0, 0, loc)
+	if start := BucketStart(monday, BucketWeek); !start.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, loc)) {
+		t.Errorf("week of a Monday starts %v", start)
+	}
+}
+
+func TestBucketWeights(t *testing.T) {
+	loc := mustLoadLocation(t, "America/New_York")
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2024, month, day, hour, 0, 0, 0, loc)
+	}
+	weights := []Weight{
+		{WeightKg: 80, RecordedAt: at(1, 29, 7)},
+		{WeightKg: 82, RecordedAt: at(1, 31, 23)}, // Feb 1 in UTC
+		{WeightKg: 81, RecordedAt: at(2, 4, 7)},   // Sunday
+		{WeightKg: 79, RecordedAt: at(2, 5, 7)},   // Monday
+		{WeightKg: 78, RecordedAt: at(2, 20, 7)},
+	}
+
+	tests := []struct {
+		bucket string
+		want   []WeightBucket
+	}{
+		{BucketWeek, []WeightBucket{
+			{Start: at(1, 29, 0), End: at(2, 5, 0), MinKg: 80, MaxKg: 82, MeanKg: 81, Count: 3},
+			{Start: at(2, 5, 0), End: at(2, 12, 0), MinKg: 79, MaxKg: 79, MeanKg: 79, Count: 1},
+			{Start: at(2, 19, 0), End: at(2, 26, 0), MinKg: 78, MaxKg: 78, MeanKg: 78, Count: 1},
+		}},
+		{BucketMonth, []WeightBucket{
+			{Start: at(1, 1, 0), End: at(2, 1, 0), MinKg: 80, MaxKg: 82, MeanKg: 81, Count: 2},
+			{Start: at(2, 1, 0), End: at(3, 1, 0), MinKg: 78, MaxKg: 81, MeanKg: 238.0 / 3, Count: 3},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bucket, func(t *testing.T) {
+			got := BucketWeights(weights, tt.bucket, loc)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d buckets, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				g := got[i]
+				if !g.Start.Equal(w.Start) || !g.End.Equal(w.End) || g.Count != w.Count ||
+					!approxEqual(g.MinKg, w.MinKg) || !approxEqual(g.MaxKg, w.MaxKg) || !approxEqual(g.MeanKg, w.MeanKg) {
+					t.Errorf("bucket %d = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
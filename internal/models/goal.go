@@ -0,0 +1,197 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+type Goal struct {
+	ID             int        `json:"id"`
+	UserID         int        `json:"user_id"`
+	StartWeightKg  float64    `json:"start_weight_kg"`
+	TargetWeightKg float64    `json:"target_weight_kg"`
+	TargetDate     *time.Time `json:"target_date"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ClosedAt       *time.Time `json:"closed_at"` // Set once a newer goal replaces it
+}
+
+// IsLoss reports whether the goal is to lose weight.
+func (g *Goal) IsLoss() bool {
+	return g.TargetWeightKg < g.StartWeightKg
+}
+
+const (
+	// minProjectionKgPerDay is the slowest trend a finish date is projected
+	// from; anything flatter is treated as a plateau.
+	minProjectionKgPerDay = 0.001
+	// maxProjectionDays is how far ahead a finish date may be projected.
+	maxProjectionDays = 5 * 365
+)
+
+// GoalProgress describes how far along a goal is at a point in time.
+type GoalProgress struct {
+	CurrentKg       float64
+	ProgressPercent float64
+	RemainingKg     float64 // Signed: negative means weight still to lose
+	Achieved        bool
+
+	// Weekly rate needed to hit the target date; nil without a future date
+	RequiredKgPerWeek *float64
+	// Weekly rate of the recent trend; nil without enough readings
+	TrendKgPerWeek *float64
+	// When the recent trend reaches the target; nil if it's heading away
+	ProjectedDate *time.Time
+}
+
+// Progress measures the goal against the current weight and, if available,
+// the recent trend.
+func (g *Goal) Progress(currentKg float64, trend *Trend, now time.Time) GoalProgress {
+	p := GoalProgress{
+		CurrentKg:   currentKg,
+		RemainingKg: g.TargetWeightKg - currentKg,
+	}
+
+	if g.IsLoss() {
+		p.Achieved = currentKg <= g.TargetWeightKg
+	} else {
+		p.Achieved = currentKg >= g.TargetWeightKg
+	}
+
+	if total := g.StartWeightKg - g.TargetWeightKg; total != 0 {
+		p.ProgressPercent = math.Max(0, math.Min(100, (g.StartWeightKg-currentKg)/total*100))
+	} else {
+		p.ProgressPercent = 100
+	}
+
+	if p.Achieved {
+		p.ProgressPercent = 100
+		return p
+	}
+
+	if g.TargetDate != nil && g.TargetDate.After(now) {
+		weeks := g.TargetDate.Sub(now).Hours() / 24 / 7
+		required := p.RemainingKg / weeks
+		p.RequiredKgPerWeek = &required
+	}
+
+	if trend != nil {
+		perWeek := trend.SlopeKgPerDay * 7
+		p.TrendKgPerWeek = &perWeek
+
+		// Only project when the trend moves towards the target fast enough
+		// to get there within the horizon. A plateau's slope is rounding
+		// noise, not a direction.
+		if math.Abs(trend.SlopeKgPerDay) >= minProjectionKgPerDay && (trend.SlopeKgPerDay < 0) == (p.RemainingKg < 0) {
+			if days := p.RemainingKg / trend.SlopeKgPerDay; days <= maxProjectionDays {
+				projected := now.Add(time.Duration(days * 24 * float64(time.Hour)))
+				p.ProjectedDate = &projected
+			}
+		}
+	}
+
+	return p
+}
+
+type GoalRepository struct {
+	db *sql.DB
+}
+
+func NewGoalRepository(db *sql.DB) *GoalRepository {
+	return &GoalRepository{db: db}
+}
+
+// Create makes goal the user's active goal, closing the previous one.
+func (r *GoalRepository) Create(goal *Goal) error {
+	if goal.TargetWeightKg < MinWeightKg || goal.TargetWeightKg > MaxWeightKg {
+		return fmt.Errorf("target weight must be between %d and %d kg", MinWeightKg, MaxWeightKg)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec(`UPDATE goals SET closed_at = ? WHERE user_id = ? AND closed_at IS NULL`,
+		now, goal.UserID); err != nil {
+		return fmt.Errorf("failed to close previous goal: %w", err)
+	}
+
+	var targetDate interface{}
+	if goal.TargetDate != nil {
+		targetDate = goal.TargetDate.UTC()
+	}
+
+	goal.CreatedAt = now
+	query := `INSERT INTO goals (user_id, start_weight_kg, target_weight_kg, target_date, created_at)
+              VALUES (?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, goal.UserID, goal.StartWeightKg, goal.TargetWeightKg, targetDate, goal.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create goal: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get goal ID: %w", err)
+	}
+	goal.ID = int(id)
+
+	return tx.Commit()
+}
+
+// GetActive returns the user's current goal, or sql.ErrNoRows if none is set.
+func (r *GoalRepository) GetActive(userID int) (*Goal, error) {
+	query := `SELECT id, user_id, start_weight_kg, target_weight_kg, target_date, created_at, closed_at
+              FROM goals WHERE user_id = ? AND closed_at IS NULL`
+	return scanGoal(r.db.QueryRow(query, userID))
+}
+
+// ListByUser returns every goal the user has set, newest first.
+func (r *GoalRepository) ListByUser(userID int) ([]Goal, error) {
+	query := `SELECT id, user_id, start_weight_kg, target_weight_kg, target_date, created_at, closed_at
+              FROM goals WHERE user_id = ? ORDER BY created_at DESC, id DESC`
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var goals []Goal
+	for rows.Next() {
+		goal, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, *goal)
+	}
+
+	return goals, rows.Err()
+}
+
+// CloseActive ends the user's current goal without setting a new one.
+func (r *GoalRepository) CloseActive(userID int) error {
+	_, err := r.db.Exec(`UPDATE goals SET closed_at = ? WHERE user_id = ? AND closed_at IS NULL`,
+		time.Now().UTC(), userID)
+	return err
+}
+
+func scanGoal(row rowScanner) (*Goal, error) {
+	var goal Goal
+	var targetDate, closedAt sql.NullTime
+	err := row.Scan(&goal.ID, &goal.UserID, &goal.StartWeightKg, &goal.TargetWeightKg,
+		&targetDate, &goal.CreatedAt, &closedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if targetDate.Valid {
+		goal.TargetDate = &targetDate.Time
+	}
+	if closedAt.Valid {
+		goal.ClosedAt = &closedAt.Time
+	}
+	return &goal, nil
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoalProgress(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	inFourWeeks := now.AddDate(0, 0, 28)
+	yesterday := now.AddDate(0, 0, -1)
+	losing := &Trend{Origin: now, InterceptKg: 90, SlopeKgPerDay: -0.1}
+	gaining := &Trend{Origin: now, InterceptKg: 90, SlopeKgPerDay: 0.1}
+	slow := &Trend{Origin: now, InterceptKg: 90, SlopeKgPerDay: -0.002}
+
+	// Identical readings fit a slope of rounding noise rather than zero
+	flat := make([]Weight, 30)
+	for i := range flat {
+		flat[i] = Weight{WeightKg: 85.3, RecordedAt: now.AddDate(0, 0, i-30)}
+	}
+	plateau, ok := FitTrend(flat)
+	if !ok {
+		t.Fatal("no trend through the plateau")
+	}
+
+	tests := []struct {
+		name       string
+		goal       Goal
+		currentKg  float64
+		trend      *Trend
+		percent    float64
+		remaining  float64
+		achieved   bool
+		required   *float64 // kg per week
+		projection *time.Time
+	}{
+		{
+			name:       "halfway to a loss",
+			goal:       Goal{StartWeightKg: 90, TargetWeightKg: 80, TargetDate: &inFourWeeks},
+			currentKg:  85,
+			trend:      losing,
+			percent:    50,
+			remaining:  -5,
+			required:   ptr(-1.25),
+			projection: ptr(now.AddDate(0, 0, 50)),
+		},
+		{
+			name:      "gain, trend heading away",
+			goal:      Goal{StartWeightKg: 60, TargetWeightKg: 65},
+			currentKg: 61,
+			trend:     losing,
+			percent:   20,
+			remaining: 4,
+		},
+		{
+			name:       "gain with a rising trend",
+			goal:       Goal{StartWeightKg: 60, TargetWeightKg: 65},
+			currentKg:  61,
+			trend:      gaining,
+			percent:    20,
+			remaining:  4,
+			projection: ptr(now.AddDate(0, 0, 40)),
+		},
+		{
+			name:      "plateau",
+			goal:      Goal{StartWeightKg: 90, TargetWeightKg: 80},
+			currentKg: 85.3,
+			trend:     plateau,
+			percent:   47,
+			remaining: -5.3,
+		},
+		{
+			name:      "too slow to finish within the horizon",
+			goal:      Goal{StartWeightKg: 90, TargetWeightKg: 80},
+			currentKg: 85,
+			trend:     slow,
+			percent:   50,
+			remaining: -5,
+		},
+		{
+			name:      "heavier than at the start",
+			goal:      Goal{StartWeightKg: 90, TargetWeightKg: 80},
+			currentKg: 92,
+			percent:   0,
+			remaining: -12,
+		},
+		{
+			name:      "past the target",
+			goal:      Goal{StartWeightKg: 90, TargetWeightKg: 80, TargetDate: &inFourWeeks},
+			currentKg: 79.5,
+			trend:     losing,
+			percent:   100,
+			remaining: 0.5,
+			achieved:  true,
+		},
+		{
+			name:      "target date has passed",
+			goal:      Goal{StartWeightKg: 90, TargetWeightKg: 80, TargetDate: &yesterday},
+			currentKg: 85,
+			percent:   50,
+			remaining: -5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.goal.Progress(tt.currentKg, tt.trend, now)
+
+			if !approxEqual(p.ProgressPercent, tt.percent) || !approxEqual(p.RemainingKg, tt.remaining) || p.Achieved != tt.achieved {
+				t.Errorf("progress = %.2f%%, remaining %.2f, achieved %v; want %.2f%%, %.2f, %v",
+					p.ProgressPercent, p.RemainingKg, p.Achieved, tt.percent, tt.remaining, tt.achieved)
+			}
+			if (p.RequiredKgPerWeek == nil) != (tt.required == nil) ||
+				tt.required != nil && !approxEqual(*p.RequiredKgPerWeek, *tt.required) {
+				t.Errorf("required rate = %v, want %v", deref(p.RequiredKgPerWeek), deref(tt.required))
+			}
+			if (p.ProjectedDate == nil) != (tt.projection == nil) ||
+				tt.projection != nil && p.ProjectedDate.Sub(*tt.projection).Abs() > time.Second {
+				t.Errorf("projected date = %v, want %v", deref(p.ProjectedDate), deref(tt.projection))
+			}
+			if tt.trend != nil && !tt.achieved && (p.TrendKgPerWeek == nil || !approxEqual(*p.TrendKgPerWeek, tt.trend.SlopeKgPerDay*7)) {
+				t.Errorf("trend rate = %v, want %v", deref(p.TrendKgPerWeek), tt.trend.SlopeKgPerDay*7)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func deref[T any](p *T) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
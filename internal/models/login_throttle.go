@@ -0,0 +1,312 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Throttle kinds: failed logins are counted per client IP and per username.
+const (
+	ThrottleIP       = "ip"
+	ThrottleUsername = "username"
+)
+
+// LoginPolicy sets how failed logins are throttled.
+type LoginPolicy struct {
+	MaxFailures      int           // Failures for one username before it is locked
+	MaxFailuresPerIP int           // Failures from one IP before it is locked
+	Window           time.Duration // Failures older than this are forgotten
+	Backoff          time.Duration // Wait after the first failure; doubles with each further one
+	Lockout          time.Duration // How long a lockout lasts
+}
+
+// Lockout is an entry in the lockout audit trail.
+type Lockout struct {
+	Kind        string
+	Value       string
+	Failures    int
+	IPAddress   string
+	LockedAt    time.Time
+	LockedUntil time.Time
+}
+
+type loginThrottle struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   *time.Time
+}
+
+// LoginThrottleRepository keeps failed login counts in the database so
+// restarting the server doesn't reset them.
+type LoginThrottleRepository struct {
+	db     *sql.DB
+	policy LoginPolicy
+}
+
+func NewLoginThrottleRepository(db *sql.DB, policy LoginPolicy) *LoginThrottleRepository {
+	return &LoginThrottleRepository{db: db, policy: policy}
+}
+
+// Reserve counts a login attempt as username from ip before its password or
+// code is checked, so parallel attempts can't all get in before the first
+// failure is recorded: each reservation starts the backoff for the next.
+// It returns how long the client must wait instead if it is throttled, in
+// which case nothing is counted. Every allowed attempt must be followed by
+// RecordFailure, RecordSuccess or Release.
+func (r *LoginThrottleRepository) Reserve(ip, username string, now time.Time) (time.Duration, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now = now.UTC()
+	keys := r.keys(ip, username)
+	throttles := make([]*loginThrottle, len(keys))
+	var wait time.Duration
+	for i, key := range keys {
+		throttle, err := r.get(tx, key.kind, key.value)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		throttles[i] = throttle
+		if until := r.allowedAt(throttle, now); until.Sub(now) > wait {
+			wait = until.Sub(now)
+		}
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+
+	for i, key := range keys {
+		failures := 1
+		var previous interface{}
+		if throttle := throttles[i]; throttle != nil && r.isCurrent(throttle, now) {
+			failures = throttle.failures + 1
+			previous = throttle.lastFailureAt
+		}
+
+		_, err = tx.Exec(`INSERT INTO login_throttles (kind, value, failures, last_failure_at, previous_failure_at, locked_until)
+                          VALUES (?, ?, ?, ?, ?, NULL)
+                          ON CONFLICT(kind, value) DO UPDATE SET failures = excluded.failures,
+                          last_failure_at = excluded.last_failure_at,
+                          previous_failure_at = excluded.previous_failure_at, locked_until = NULL`,
+			key.kind, key.value, failures, now, previous)
+		if err != nil {
+			return 0, fmt.Errorf("failed to reserve login attempt: %w", err)
+		}
+	}
+
+	return 0, tx.Commit()
+}
+
+// RecordFailure marks a reserved attempt as failed, locking the IP or the
+// username once it has reached its limit. It returns the lockouts this
+// failure started, which are also written to the audit trail.
+func (r *LoginThrottleRepository) RecordFailure(ip, username string, now time.Time) ([]Lockout, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now = now.UTC()
+	var lockouts []Lockout
+	for _, key := range r.keys(ip, username) {
+		throttle, err := r.get(tx, key.kind, key.value)
+		if err == sql.ErrNoRows {
+			// Unlocked by an admin since the attempt was reserved
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if throttle.failures < key.max || throttle.lockedUntil != nil {
+			continue
+		}
+
+		until := now.Add(r.policy.Lockout)
+		lockouts = append(lockouts, Lockout{
+			Kind:        key.kind,
+			Value:       key.value,
+			Failures:    throttle.failures,
+			IPAddress:   ip,
+			LockedAt:    now,
+			LockedUntil: until,
+		})
+		_, err = tx.Exec(`UPDATE login_throttles SET locked_until = ? WHERE kind = ? AND value = ?`,
+			until, key.kind, key.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record login failure: %w", err)
+		}
+	}
+
+	for _, l := range lockouts {
+		_, err := tx.Exec(`INSERT INTO login_lockouts (kind, value, failures, ip_address, locked_at, locked_until)
+                           VALUES (?, ?, ?, ?, ?, ?)`,
+			l.Kind, l.Value, l.Failures, l.IPAddress, l.LockedAt, l.LockedUntil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record lockout: %w", err)
+		}
+	}
+
+	return lockouts, tx.Commit()
+}
+
+// RecordSuccess marks a reserved attempt as successful: the failures counted
+// against username are cleared and the IP gets its attempt back. The IP's
+// earlier failures are kept, so logging in to one account doesn't reset
+// guessing at others.
+func (r *LoginThrottleRepository) RecordSuccess(ip, username string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM login_throttles WHERE kind = ? AND value = ?`, ThrottleUsername, username); err != nil {
+		return err
+	}
+	if err := r.release(tx, ThrottleIP, ip); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Release gives back a reserved attempt that neither failed nor completed a
+// login, such as a correct password still awaiting its two-factor code.
+func (r *LoginThrottleRepository) Release(ip, username string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, key := range r.keys(ip, username) {
+		if err := r.release(tx, key.kind, key.value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// release takes a reserved attempt off the count and puts back the time of
+// the failure before it, which the backoff is measured from.
+func (r *LoginThrottleRepository) release(tx *sql.Tx, kind, value string) error {
+	_, err := tx.Exec(`UPDATE login_throttles SET failures = failures - 1,
+                       last_failure_at = COALESCE(previous_failure_at, last_failure_at), previous_failure_at = NULL
+                       WHERE kind = ? AND value = ? AND failures > 0 AND locked_until IS NULL`, kind, value)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM login_throttles WHERE kind = ? AND value = ? AND failures = 0`, kind, value)
+	return err
+}
+
+// Unlock clears the failures and any lockout for value, which may be a
+// username or an IP address. It reports how many counts were cleared.
+func (r *LoginThrottleRepository) Unlock(value string) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM login_throttles WHERE value = ?`, value)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Purge removes counts that have expired and returns how many were removed.
+// The lockout audit trail is kept.
+func (r *LoginThrottleRepository) Purge(now time.Time) (int64, error) {
+	now = now.UTC()
+	result, err := r.db.Exec(`DELETE FROM login_throttles WHERE last_failure_at < ?
+                              AND (locked_until IS NULL OR locked_until < ?)`, now.Add(-r.policy.Window), now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListLockouts returns the most recent lockouts, newest first.
+func (r *LoginThrottleRepository) ListLockouts(limit int) ([]Lockout, error) {
+	rows, err := r.db.Query(`SELECT kind, value, failures, ip_address, locked_at, locked_until
+                             FROM login_lockouts ORDER BY locked_at DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lockouts []Lockout
+	for rows.Next() {
+		var l Lockout
+		if err := rows.Scan(&l.Kind, &l.Value, &l.Failures, &l.IPAddress, &l.LockedAt, &l.LockedUntil); err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, l)
+	}
+	return lockouts, rows.Err()
+}
+
+type throttleKey struct {
+	kind  string
+	value string
+	max   int
+}
+
+func (r *LoginThrottleRepository) keys(ip, username string) []throttleKey {
+	return []throttleKey{
+		{kind: ThrottleIP, value: ip, max: r.policy.MaxFailuresPerIP},
+		{kind: ThrottleUsername, value: username, max: r.policy.MaxFailures},
+	}
+}
+
+// isCurrent reports whether the throttle's failures still count: they are
+// forgotten once the window has passed or a lockout has run out.
+func (r *LoginThrottleRepository) isCurrent(t *loginThrottle, now time.Time) bool {
+	if t.lockedUntil != nil {
+		return now.Before(*t.lockedUntil)
+	}
+	return now.Sub(t.lastFailureAt) < r.policy.Window
+}
+
+// allowedAt returns when the next attempt is allowed: after a lockout ends,
+// or after a backoff that doubles with each failure, capped at the lockout.
+func (r *LoginThrottleRepository) allowedAt(t *loginThrottle, now time.Time) time.Time {
+	if !r.isCurrent(t, now) {
+		return now
+	}
+	if t.lockedUntil != nil {
+		return *t.lockedUntil
+	}
+
+	backoff := r.policy.Backoff
+	for i := 1; i < t.failures && backoff < r.policy.Lockout; i++ {
+		backoff *= 2
+	}
+	if backoff > r.policy.Lockout {
+		backoff = r.policy.Lockout
+	}
+	return t.lastFailureAt.Add(backoff)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (r *LoginThrottleRepository) get(q queryRower, kind, value string) (*loginThrottle, error) {
+	var t loginThrottle
+	var lockedUntil sql.NullTime
+	err := q.QueryRow(`SELECT failures, last_failure_at, locked_until FROM login_throttles WHERE kind = ? AND value = ?`,
+		kind, value).Scan(&t.failures, &t.lastFailureAt, &lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	if lockedUntil.Valid {
+		t.lockedUntil = &lockedUntil.Time
+	}
+	return &t, nil
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testLoginPolicy = LoginPolicy{
+	MaxFailures:      3,
+	MaxFailuresPerIP: 5,
+	Window:           10 * time.Minute,
+	Backoff:          time.Second,
+	Lockout:          15 * time.Minute,
+}
+
+// mustRecordFailure makes a login attempt that fails.
+func mustRecordFailure(t *testing.T, repo *LoginThrottleRepository, ip, username string, now time.Time) []Lockout {
+	t.Helper()
+
+	if wait, err := repo.Reserve(ip, username, now); err != nil || wait != 0 {
+		t.Fatalf("reserve = %s, %v; want the attempt allowed", wait, err)
+	}
+	lockouts, err := repo.RecordFailure(ip, username, now)
+	if err != nil {
+		t.Fatalf("record failure: %v", err)
+	}
+	return lockouts
+}
+
+// mustCheck returns how long an attempt would have to wait, without
+// counting it.
+func mustCheck(t *testing.T, repo *LoginThrottleRepository, ip, username string, now time.Time) time.Duration {
+	t.Helper()
+
+	wait, err := repo.Reserve(ip, username, now)
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if wait == 0 {
+		if err := repo.Release(ip, username); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+	}
+	return wait
+}
+
+func TestLoginThrottleBackoffAndLockout(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewLoginThrottleRepository(db, testLoginPolicy)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if wait := mustCheck(t, repo, "10.0.0.1", "alice", now); wait != 0 {
+		t.Fatalf("fresh client must wait %s", wait)
+	}
+
+	mustRecordFailure(t, repo, "10.0.0.1", "alice", now)
+	if wait := mustCheck(t, repo, "10.0.0.1", "alice", now); wait != time.Second {
+		t.Errorf("after one failure wait = %s, want 1s", wait)
+	}
+
+	now = now.Add(time.Second)
+	mustRecordFailure(t, repo, "10.0.0.1", "alice", now)
+	if wait := mustCheck(t, repo, "10.0.0.1", "alice", now); wait != 2*time.Second {
+		t.Errorf("after two failures wait = %s, want 2s", wait)
+	}
+
+	now = now.Add(2 * time.Second)
+	lockouts := mustRecordFailure(t, repo, "10.0.0.1", "alice", now)
+	if len(lockouts) != 1 || lockouts[0].Kind != ThrottleUsername || lockouts[0].Value != "alice" {
+		t.Fatalf("lockouts = %+v, want alice locked", lockouts)
+	}
+
+	// The lockout is kept in the database, so a new repository sees it
+	repo = NewLoginThrottleRepository(db, testLoginPolicy)
+	if wait := mustCheck(t, repo, "10.0.0.2", "alice", now.Add(time.Minute)); wait != 14*time.Minute {
+		t.Errorf("locked username from another IP must wait %s, want 14m", wait)
+	}
+	if wait := mustCheck(t, repo, "10.0.0.2", "bob", now.Add(time.Minute)); wait != 0 {
+		t.Errorf("other user from another IP must wait %s", wait)
+	}
+
+	audit, err := repo.ListLockouts(10)
+	if err != nil || len(audit) != 1 || audit[0].IPAddress != "10.0.0.1" {
+		t.Fatalf("audit = %+v, %v; want one lockout from 10.0.0.1", audit, err)
+	}
+
+	// Once the lockout ends the count starts again
+	now = now.Add(testLoginPolicy.Lockout)
+	if wait := mustCheck(t, repo, "10.0.0.2", "alice", now); wait != 0 {
+		t.Errorf("after the lockout wait = %s, want 0", wait)
+	}
+	if lockouts := mustRecordFailure(t, repo, "10.0.0.2", "alice", now); len(lockouts) != 0 {
+		t.Errorf("first failure after a lockout locked again: %+v", lockouts)
+	}
+}
+
+func TestLoginThrottlePerIP(t *testing.T) {
+	repo := NewLoginThrottleRepository(newTestDB(t), testLoginPolicy)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// One IP guessing a different username each time
+	var lockouts []Lockout
+	for i, username := range []string{"a", "b", "c", "d", "e"} {
+		now = now.Add(time.Minute)
+		lockouts = mustRecordFailure(t, repo, "10.0.0.9", username, now)
+		if i < 4 && len(lockouts) != 0 {
+			t.Fatalf("locked after %d failures", i+1)
+		}
+	}
+	if len(lockouts) != 1 || lockouts[0].Kind != ThrottleIP {
+		t.Fatalf("lockouts = %+v, want the IP locked", lockouts)
+	}
+
+	// A successful login doesn't clear the IP
+	if err := repo.RecordSuccess("10.0.0.9", "f"); err != nil {
+		t.Fatalf("record success: %v", err)
+	}
+	if wait := mustCheck(t, repo, "10.0.0.9", "f", now); wait != testLoginPolicy.Lockout {
+		t.Errorf("wait = %s, want %s", wait, testLoginPolicy.Lockout)
+	}
+
+	if _, err := repo.Unlock("10.0.0.9"); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if wait := mustCheck(t, repo, "10.0.0.9", "f", now); wait != 0 {
+		t.Errorf("after unlock wait = %s, want 0", wait)
+	}
+}
+
+func TestLoginThrottleWindow(t *testing.T) {
+	repo := NewLoginThrottleRepository(newTestDB(t), testLoginPolicy)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	mustRecordFailure(t, repo, "10.0.0.1", "alice", now)
+	mustRecordFailure(t, repo, "10.0.0.1", "alice", now.Add(time.Minute))
+
+	// Failures outside the window are forgotten
+	later := now.Add(time.Minute + testLoginPolicy.Window)
+	if lockouts := mustRecordFailure(t, repo, "10.0.0.1", "alice", later); len(lockouts) != 0 {
+		t.Errorf("stale failures counted towards a lockout: %+v", lockouts)
+	}
+
+	if n, err := repo.Purge(later.Add(testLoginPolicy.Window + time.Second)); err != nil || n != 2 {
+		t.Errorf("purge = %d, %v; want 2, nil", n, err)
+	}
+}
+
+func TestLoginThrottleParallelAttempts(t *testing.T) {
+	repo := NewLoginThrottleRepository(newTestDB(t), testLoginPolicy)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// A burst of guesses arriving together: only the first gets to check
+	// its password, the rest wait for its backoff
+	const attempts = 10
+	var wg sync.WaitGroup
+	var allowed atomic.Int32
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := repo.Reserve("10.0.0.1", "alice", now)
+			if err != nil {
+				t.Errorf("reserve: %v", err)
+				return
+			}
+			if wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := allowed.Load(); n != 1 {
+		t.Errorf("%d of %d parallel attempts allowed, want 1", n, attempts)
+	}
+}
+
+func TestLoginThrottleSuccessGivesAttemptBack(t *testing.T) {
+	repo := NewLoginThrottleRepository(newTestDB(t), testLoginPolicy)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	failedAt := now
+	mustRecordFailure(t, repo, "10.0.0.1", "alice", failedAt)
+	now = now.Add(time.Second)
+	if wait, err := repo.Reserve("10.0.0.1", "alice", now); err != nil || wait != 0 {
+		t.Fatalf("reserve = %s, %v", wait, err)
+	}
+	if err := repo.RecordSuccess("10.0.0.1", "alice"); err != nil {
+		t.Fatalf("record success: %v", err)
+	}
+
+	// The username is cleared and the IP is back to its one real failure
+	if wait := mustCheck(t, repo, "10.0.0.2", "alice", now); wait != 0 {
+		t.Errorf("username still throttled: wait %s", wait)
+	}
+	if wait := mustCheck(t, repo, "10.0.0.1", "bob", now); wait != 0 {
+		t.Errorf("IP wait = %s, want the backoff to run from the failure", wait)
+	}
+	if wait := mustCheck(t, repo, "10.0.0.1", "bob", failedAt.Add(time.Second/2)); wait != time.Second/2 {
+		t.Errorf("IP wait = %s, want 500ms left of one failure's backoff", wait)
+	}
+}
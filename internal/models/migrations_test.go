@@ -0,0 +1,75 @@
+package models
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUTCTimestampsMigration(t *testing.T) {
+	db := newTestDB(t)
+
+	legacy := []struct {
+		stored string
+		want   string
+	}{
+		{"2024-01-02 08:30:00 +0100 CET", "2024-01-02 07:30:00+00:00"},
+		{"2024-07-02 08:30:00.25 +0200 CEST m=+0.012345678", "2024-07-02 06:30:00.25+00:00"},
+		{"2024-01-02 23:15:00 -0500 EST", "2024-01-03 04:15:00+00:00"},
+		{"2024-03-10 12:00:00 +0530 +0530", "2024-03-10 06:30:00+00:00"},
+		{"2024-01-05 09:00:00", "2024-01-05 09:00:00+00:00"},
+		{"2024-01-06 09:00:00+00:00", "2024-01-06 09:00:00+00:00"},
+	}
+	for _, l := range legacy {
+		_, err := db.Exec(`INSERT INTO weights (user_id, weight_kg, recorded_at, notes, created_at, updated_at) VALUES (1, 80, ?, '', ?, ?)`,
+			l.stored, l.stored, l.stored)
+		if err != nil {
+			t.Fatalf("insert legacy weight: %v", err)
+		}
+	}
+	if _, err := db.Exec(`UPDATE users SET created_at = '2023-12-31 18:00:00 -0800 PST' WHERE id = 1`); err != nil {
+		t.Fatalf("set legacy user time: %v", err)
+	}
+
+	migration, err := os.ReadFile("../../migrations/010_utc_timestamps.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	if _, err := db.Exec(string(migration)); err != nil {
+		t.Fatalf("apply migration: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT CAST(recorded_at AS TEXT), CAST(created_at AS TEXT), CAST(updated_at AS TEXT) FROM weights ORDER BY id`)
+	if err != nil {
+		t.Fatalf("query weights: %v", err)
+	}
+	defer rows.Close()
+	for i := 0; rows.Next(); i++ {
+		var recordedAt, createdAt, updatedAt string
+		if err := rows.Scan(&recordedAt, &createdAt, &updatedAt); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		want := legacy[i].want
+		if recordedAt != want || createdAt != want || updatedAt != want {
+			t.Errorf("%q became %q, %q, %q; want %q", legacy[i].stored, recordedAt, createdAt, updatedAt, want)
+		}
+	}
+
+	var userCreatedAt string
+	if err := db.QueryRow(`SELECT CAST(created_at AS TEXT) FROM users WHERE id = 1`).Scan(&userCreatedAt); err != nil {
+		t.Fatalf("query user: %v", err)
+	}
+	if userCreatedAt != "2024-01-01 02:00:00+00:00" {
+		t.Errorf("user created_at = %q", userCreatedAt)
+	}
+
+	// Range queries now see the readings at their real instants
+	weights, err := NewWeightRepository(db).GetRange(1,
+		time.Date(2024, 1, 2, 7, 30, 0, 0, time.UTC), time.Date(2024, 1, 3, 4, 15, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("get range: %v", err)
+	}
+	if len(weights) != 1 || !weights[0].RecordedAt.Equal(time.Date(2024, 1, 2, 7, 30, 0, 0, time.UTC)) {
+		t.Errorf("got %+v, want only the 07:30 UTC reading", weights)
+	}
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// PasswordResetTTL is how long a reset code stays valid.
+	PasswordResetTTL = time.Hour
+
+	// resetCodeBytes gives reset codes 80 bits of randomness.
+	resetCodeBytes = 10
+)
+
+var ErrInvalidResetCode = errors.New("invalid or expired reset code")
+
+// PasswordResetRepository issues one-time codes that let a user choose a new
+// password without knowing the old one. There is no email, so codes are
+// generated by an administrator and handed over directly.
+type PasswordResetRepository struct {
+	db *sql.DB
+}
+
+func NewPasswordResetRepository(db *sql.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// Create issues a reset code for the user, replacing any earlier one. Only
+// its hash is stored, so the returned code can't be shown again.
+func (r *PasswordResetRepository) Create(userID int) (string, time.Time, error) {
+	code, err := generateCode(resetCodeBytes)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate reset code: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM password_resets WHERE user_id = ?`, userID); err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(PasswordResetTTL)
+	_, err = tx.Exec(`INSERT INTO password_resets (user_id, code_hash, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		userID, hashToken(normalizeCode(code)), now, expiresAt)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create reset code: %w", err)
+	}
+
+	return code, expiresAt, tx.Commit()
+}
+
+// Redeem sets a new password for the user the code was issued to, uses up
+// the code and ends all of the user's sessions. Unknown, used and expired
+// codes return ErrInvalidResetCode.
+func (r *PasswordResetRepository) Redeem(code, password string) (int, error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id, userID int
+	var expiresAt time.Time
+	err = tx.QueryRow(`SELECT id, user_id, expires_at FROM password_resets WHERE code_hash = ?`,
+		hashToken(normalizeCode(code))).Scan(&id, &userID, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return 0, ErrInvalidResetCode
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM password_resets WHERE id = ?`, id); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE users SET password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		hash, userID); err != nil {
+		return 0, fmt.Errorf("failed to update password: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		return 0, fmt.Errorf("failed to end sessions: %w", err)
+	}
+
+	return userID, tx.Commit()
+}
+
+// generateCode returns n random bytes as groups of four base32 characters,
+// which is easy to read out and type, e.g. "K7QM-2XRD-PW4H-ZT6B" for 10 bytes.
+func generateCode(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	raw := strings.TrimRight(base32.StdEncoding.EncodeToString(b), "=")
+	var groups []string
+	for i := 0; i < len(raw); i += 4 {
+		groups = append(groups, raw[i:min(i+4, len(raw))])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// normalizeCode ignores case, dashes and spaces in a typed code.
+func normalizeCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
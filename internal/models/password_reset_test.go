@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPasswordResetRedeem(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserRepository(db)
+	resets := NewPasswordResetRepository(db)
+	user := mustCreateUser(t, users, "dave")
+
+	if _, err := NewSessionRepository(db).Create(user.ID, "test", "127.0.0.1"); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	first, _, err := resets.Create(user.ID)
+	if err != nil {
+		t.Fatalf("create code: %v", err)
+	}
+	code, _, err := resets.Create(user.ID)
+	if err != nil {
+		t.Fatalf("create code: %v", err)
+	}
+
+	if _, err := resets.Redeem(first, "newpassword"); !errors.Is(err, ErrInvalidResetCode) {
+		t.Errorf("replaced code: err = %v, want ErrInvalidResetCode", err)
+	}
+	if _, err := resets.Redeem(code, "short"); err == nil {
+		t.Error("a too short password was accepted")
+	}
+
+	// Codes are accepted however they are typed
+	typed := strings.ToLower(strings.ReplaceAll(code, "-", " "))
+	userID, err := resets.Redeem(typed, "newpassword")
+	if err != nil || userID != user.ID {
+		t.Fatalf("redeem = %d, %v; want %d, nil", userID, err, user.ID)
+	}
+
+	updated, err := users.GetByID(user.ID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if !users.VerifyPassword(updated, "newpassword") {
+		t.Error("password was not changed")
+	}
+	if sessions, _ := NewSessionRepository(db).ListByUser(user.ID); len(sessions) != 0 {
+		t.Errorf("%d sessions left after reset", len(sessions))
+	}
+
+	if _, err := resets.Redeem(code, "otherpassword"); !errors.Is(err, ErrInvalidResetCode) {
+		t.Errorf("reused code: err = %v, want ErrInvalidResetCode", err)
+	}
+}
+
+func TestPasswordResetExpiry(t *testing.T) {
+	db := newTestDB(t)
+	resets := NewPasswordResetRepository(db)
+
+	code, _, err := resets.Create(1)
+	if err != nil {
+		t.Fatalf("create code: %v", err)
+	}
+	_, err = db.Exec(`UPDATE password_resets SET expires_at = ?`, time.Now().Add(-time.Minute).UTC())
+	if err != nil {
+		t.Fatalf("expire code: %v", err)
+	}
+
+	if _, err := resets.Redeem(code, "newpassword"); !errors.Is(err, ErrInvalidResetCode) {
+		t.Errorf("expired code: err = %v, want ErrInvalidResetCode", err)
+	}
+}
@@ -0,0 +1,210 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// SessionIdleTimeout is how long a session survives without any requests.
+	SessionIdleTimeout = 7 * 24 * time.Hour
+	// SessionMaxAge is the absolute lifetime of a session, regardless of activity.
+	SessionMaxAge = 30 * 24 * time.Hour
+
+	// sessionTouchInterval limits how often last_seen_at is written back.
+	sessionTouchInterval = time.Minute
+)
+
+var ErrSessionExpired = errors.New("session expired")
+
+type Session struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Token      string    `json:"-"` // Only populated when the session is created
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// IsExpired reports whether the session has passed its idle or absolute expiry.
+func (s *Session) IsExpired(now time.Time) bool {
+	return now.After(s.ExpiresAt) || now.After(s.LastSeenAt.Add(SessionIdleTimeout))
+}
+
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+func (r *SessionRepository) Create(userID int, userAgent, ipAddress string) (*Session, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	now := time.Now().UTC()
+	session := &Session{
+		UserID:     userID,
+		Token:      token,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(SessionMaxAge),
+	}
+
+	query := `INSERT INTO sessions (user_id, token_hash, user_agent, ip_address, created_at, last_seen_at, expires_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := r.db.Exec(query, session.UserID, hashToken(token), session.UserAgent, session.IPAddress,
+		session.CreatedAt, session.LastSeenAt, session.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session ID: %w", err)
+	}
+
+	session.ID = int(id)
+	return session, nil
+}
+
+// GetByToken looks up a session by its raw cookie token. Expired sessions are
+// removed and reported as ErrSessionExpired.
+func (r *SessionRepository) GetByToken(token string) (*Session, error) {
+	query := `SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at
+              FROM sessions WHERE token_hash = ?`
+	row := r.db.QueryRow(query, hashToken(token))
+
+	var session Session
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.IsExpired(time.Now()) {
+		if err := r.Delete(session.ID, session.UserID); err != nil {
+			return nil, err
+		}
+		return nil, ErrSessionExpired
+	}
+
+	return &session, nil
+}
+
+// Touch records activity on the session. Writes are throttled so that a page
+// full of requests only updates the row once.
+func (r *SessionRepository) Touch(session *Session) error {
+	now := time.Now().UTC()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return nil
+	}
+
+	query := `UPDATE sessions SET last_seen_at = ? WHERE id = ?`
+	if _, err := r.db.Exec(query, now, session.ID); err != nil {
+		return err
+	}
+
+	session.LastSeenAt = now
+	return nil
+}
+
+// ListByUser returns the user's active sessions, most recently used first.
+func (r *SessionRepository) ListByUser(userID int) ([]Session, error) {
+	now := time.Now().UTC()
+	query := `SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at
+              FROM sessions WHERE user_id = ? AND expires_at >= ? AND last_seen_at >= ?
+              ORDER BY last_seen_at DESC`
+	rows, err := r.db.Query(query, userID, now, now.Add(-SessionIdleTimeout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Delete ends one of the user's sessions. It returns sql.ErrNoRows if the
+// user has no session with that ID.
+func (r *SessionRepository) Delete(id, userID int) error {
+	query := `DELETE FROM sessions WHERE id = ? AND user_id = ?`
+	result, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *SessionRepository) DeleteByToken(token string) error {
+	query := `DELETE FROM sessions WHERE token_hash = ?`
+	_, err := r.db.Exec(query, hashToken(token))
+	return err
+}
+
+// DeleteOthers revokes every session of the user except keepID.
+func (r *SessionRepository) DeleteOthers(userID, keepID int) (int64, error) {
+	query := `DELETE FROM sessions WHERE user_id = ? AND id != ?`
+	result, err := r.db.Exec(query, userID, keepID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteExpired removes every session past its idle or absolute expiry.
+func (r *SessionRepository) DeleteExpired() (int64, error) {
+	now := time.Now().UTC()
+	query := `DELETE FROM sessions WHERE expires_at < ? OR last_seen_at < ?`
+	result, err := r.db.Exec(query, now, now.Add(-SessionIdleTimeout))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// generateToken returns a random, URL-safe token with 256 bits of entropy.
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a token. Only hashes are stored so a
+// leaked database can't be replayed as live sessions.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionIsExpired(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	session := Session{CreatedAt: created, LastSeenAt: created, ExpiresAt: created.Add(SessionMaxAge)}
+	active := session
+	active.LastSeenAt = session.ExpiresAt.Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		session Session
+		now     time.Time
+		want    bool
+	}{
+		{"fresh", session, created.Add(time.Hour), false},
+		{"at the idle limit", session, created.Add(SessionIdleTimeout), false},
+		{"idle too long", session, created.Add(SessionIdleTimeout + time.Second), true},
+		{"active at the absolute limit", active, session.ExpiresAt, false},
+		{"active past the absolute limit", active, session.ExpiresAt.Add(time.Second), true},
+	}
+	for _, tt := range tests {
+		if got := tt.session.IsExpired(tt.now); got != tt.want {
+			t.Errorf("%s: IsExpired = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSessionGetByTokenDeletesExpired(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewSessionRepository(db)
+
+	tests := []struct {
+		name   string
+		column string
+		age    time.Duration
+	}{
+		{"idle", "last_seen_at", SessionIdleTimeout + time.Minute},
+		{"past its lifetime", "expires_at", time.Minute},
+	}
+	for _, tt := range tests {
+		session, err := repo.Create(1, "test", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		if _, err := db.Exec(`UPDATE sessions SET `+tt.column+` = ? WHERE id = ?`, time.Now().UTC().Add(-tt.age), session.ID); err != nil {
+			t.Fatalf("age session: %v", err)
+		}
+
+		if _, err := repo.GetByToken(session.Token); !errors.Is(err, ErrSessionExpired) {
+			t.Errorf("%s: err = %v, want ErrSessionExpired", tt.name, err)
+		}
+		if _, err := repo.GetByToken(session.Token); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("%s: second lookup err = %v, want the row deleted", tt.name, err)
+		}
+	}
+
+	if _, err := repo.GetByToken("unknown"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown token: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestSessionTouch(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewSessionRepository(db)
+
+	session, err := repo.Create(1, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	lastSeen := func() time.Time {
+		t.Helper()
+		stored, err := repo.GetByToken(session.Token)
+		if err != nil {
+			t.Fatalf("get session: %v", err)
+		}
+		return stored.LastSeenAt
+	}
+
+	// A second request straight away doesn't write
+	created := session.LastSeenAt
+	if _, err := db.Exec(`UPDATE sessions SET last_seen_at = ? WHERE id = ?`, created.Add(-time.Hour), session.ID); err != nil {
+		t.Fatalf("age session: %v", err)
+	}
+	if err := repo.Touch(session); err != nil {
+		t.Fatalf("touch: %v", err)
+	}
+	if got := lastSeen(); !got.Equal(created.Add(-time.Hour)) {
+		t.Errorf("touched within the interval: last seen %v", got)
+	}
+
+	// Once the interval has passed it does
+	session.LastSeenAt = created.Add(-sessionTouchInterval)
+	if err := repo.Touch(session); err != nil {
+		t.Fatalf("touch: %v", err)
+	}
+	if got := lastSeen(); !got.After(created) || !got.Equal(session.LastSeenAt) {
+		t.Errorf("last seen %v, want the time of the touch %v", got, session.LastSeenAt)
+	}
+}
+
+func TestSessionDeleteOthers(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewSessionRepository(db)
+
+	var sessions []*Session
+	for _, userID := range []int{1, 1, 1, 2} {
+		session, err := repo.Create(userID, "test", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	n, err := repo.DeleteOthers(1, sessions[0].ID)
+	if err != nil {
+		t.Fatalf("delete others: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("deleted %d sessions, want 2", n)
+	}
+
+	for i, want := range []bool{true, false, false, true} {
+		_, err := repo.GetByToken(sessions[i].Token)
+		if kept := err == nil; kept != want {
+			t.Errorf("session %d kept = %v, want %v (err %v)", i, kept, want, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Keys of per-user rows in the settings table.
+const (
+	SettingEntryMode        = "entry_mode"
+	SettingDailyAggregation = "daily_aggregation"
+	SettingTimezone         = "timezone"
+	SettingUnit             = "unit"
+)
+
+// Entry modes: how a new reading is stored when the day already has one.
+const (
+	EntryModeDaily    = "daily"    // one entry per day, later readings overwrite it
+	EntryModeMultiple = "multiple" // keep every reading
+)
+
+// Daily aggregations: which reading represents a day in charts and stats.
+const (
+	AggregateFirst = "first"
+	AggregateLast  = "last"
+	AggregateMin   = "min"
+	AggregateMean  = "mean"
+)
+
+// Settings holds a user's preferences. Missing rows fall back to the values
+// from DefaultSettings.
+type Settings struct {
+	EntryMode        string `json:"entry_mode"`
+	DailyAggregation string `json:"daily_aggregation"`
+	Timezone         string `json:"timezone"` // IANA name, e.g. "Europe/Berlin"
+	Unit             string `json:"unit"`     // Display and input unit
+}
+
+func DefaultSettings() *Settings {
+	return &Settings{
+		EntryMode:        EntryModeDaily,
+		DailyAggregation: AggregateLast,
+		Timezone:         "UTC",
+		Unit:             UnitKg,
+	}
+}
+
+// Location returns the user's timezone, which decides where days start and
+// end. Timestamps are stored in UTC and converted with it for display.
+func (s *Settings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// AllowsMultiplePerDay reports whether every reading is kept as its own entry.
+func (s *Settings) AllowsMultiplePerDay() bool {
+	return s.EntryMode == EntryModeMultiple
+}
+
+func (s *Settings) Validate() error {
+	switch s.EntryMode {
+	case EntryModeDaily, EntryModeMultiple:
+	default:
+		return fmt.Errorf("invalid entry mode %q", s.EntryMode)
+	}
+
+	switch s.DailyAggregation {
+	case AggregateFirst, AggregateLast, AggregateMin, AggregateMean:
+	default:
+		return fmt.Errorf("invalid daily aggregation %q", s.DailyAggregation)
+	}
+
+	if !ValidUnit(s.Unit) {
+		return fmt.Errorf("invalid unit %q", s.Unit)
+	}
+
+	// "Local" would silently follow the server's zone
+	if s.Timezone == "" || s.Timezone == "Local" {
+		return fmt.Errorf("invalid timezone %q", s.Timezone)
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+
+	return nil
+}
+
+// values returns the settings as key/value rows for storage.
+func (s *Settings) values() map[string]string {
+	return map[string]string{
+		SettingEntryMode:        s.EntryMode,
+		SettingDailyAggregation: s.DailyAggregation,
+		SettingTimezone:         s.Timezone,
+		SettingUnit:             s.Unit,
+	}
+}
+
+func (s *Settings) set(key, value string) {
+	switch key {
+	case SettingEntryMode:
+		s.EntryMode = value
+	case SettingDailyAggregation:
+		s.DailyAggregation = value
+	case SettingTimezone:
+		s.Timezone = value
+	case SettingUnit:
+		s.Unit = value
+	}
+}
+
+type SettingsRepository struct {
+	db *sql.DB
+}
+
+func NewSettingsRepository(db *sql.DB) *SettingsRepository {
+	return &SettingsRepository{db: db}
+}
+
+func (r *SettingsRepository) Get(userID int) (*Settings, error) {
+	rows, err := r.db.Query(`SELECT key, value FROM settings WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := DefaultSettings()
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+
+		// A stored value this version doesn't understand falls back to the
+		// default for that setting only
+		candidate := *settings
+		candidate.set(key, value)
+		if err := candidate.Validate(); err != nil {
+			log.Printf("Ignoring setting %s of user %d: %v", key, userID, err)
+			continue
+		}
+		settings = &candidate
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (r *SettingsRepository) Save(userID int, settings *Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO settings (user_id, key, value) VALUES (?, ?, ?)
+              ON CONFLICT(user_id, key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`
+	for key, value := range settings.values() {
+		if _, err := tx.Exec(query, userID, key, value); err != nil {
+			return fmt.Errorf("failed to save setting %s: %w", key, err)
+		}
+	}
+
+	return tx.Commit()
+}
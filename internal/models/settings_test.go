@@ -0,0 +1,37 @@
+package models
+
+import "testing"
+
+func TestSettingsGetFallsBackPerKey(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewSettingsRepository(db)
+
+	_, err := db.Exec(`INSERT INTO settings (user_id, key, value) VALUES
+		(1, 'entry_mode', 'multiple'),
+		(1, 'daily_aggregation', 'median'),
+		(1, 'timezone', 'Europe/Berlin'),
+		(1, 'unit', 'furlongs'),
+		(1, 'theme', 'dark'),
+		(2, 'timezone', 'Local'),
+		(2, 'unit', 'lb')`)
+	if err != nil {
+		t.Fatalf("insert settings: %v", err)
+	}
+
+	tests := []struct {
+		userID int
+		want   Settings
+	}{
+		{1, Settings{EntryMode: EntryModeMultiple, DailyAggregation: AggregateLast, Timezone: "Europe/Berlin", Unit: UnitKg}},
+		{2, Settings{EntryMode: EntryModeDaily, DailyAggregation: AggregateLast, Timezone: "UTC", Unit: UnitLb}},
+	}
+	for _, tt := range tests {
+		got, err := repo.Get(tt.userID)
+		if err != nil {
+			t.Fatalf("get settings: %v", err)
+		}
+		if *got != tt.want {
+			t.Errorf("user %d: got %+v, want %+v", tt.userID, *got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Trend is a least-squares line through a series of readings:
+// weight = InterceptKg + SlopeKgPerDay * (days since Origin).
+type Trend struct {
+	Origin        time.Time
+	InterceptKg   float64
+	SlopeKgPerDay float64
+}
+
+// FitTrend fits a line through the readings. It needs at least two readings
+// on different instants.
+func FitTrend(weights []Weight) (*Trend, bool) {
+	if len(weights) < 2 {
+		return nil, false
+	}
+
+	origin := weights[0].RecordedAt
+	for _, w := range weights {
+		if w.RecordedAt.Before(origin) {
+			origin = w.RecordedAt
+		}
+	}
+
+	n := float64(len(weights))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, w := range weights {
+		x := w.RecordedAt.Sub(origin).Hours() / 24
+		sumX += x
+		sumY += w.WeightKg
+		sumXY += x * w.WeightKg
+		sumXX += x * x
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return nil, false
+	}
+
+	slope := (n*sumXY - sumX*sumY) / denominator
+	return &Trend{
+		Origin:        origin,
+		InterceptKg:   (sumY - slope*sumX) / n,
+		SlopeKgPerDay: slope,
+	}, true
+}
+
+// At returns the trend's weight at the given time.
+func (t *Trend) At(when time.Time) float64 {
+	return t.InterceptKg + t.SlopeKgPerDay*when.Sub(t.Origin).Hours()/24
+}
+
+const (
+	// MovingAverageDays is the window of the moving average, in calendar days.
+	MovingAverageDays = 7
+	// TrendSmoothing is how far each day moves the smoothed trend towards that
+	// day's reading, as in The Hacker's Diet.
+	TrendSmoothing = 0.1
+)
+
+// MovingAverage returns, for each reading, the mean of the readings from the
+// days calendar days ending on its day. Readings must be in ascending order.
+func MovingAverage(weights []Weight, days int, loc *time.Location) []float64 {
+	averages := make([]float64, len(weights))
+
+	start, sum := 0, 0.0
+	for i, w := range weights {
+		sum += w.WeightKg
+		windowStart := StartOfDay(w.RecordedAt.In(loc)).AddDate(0, 0, -(days - 1))
+		for weights[start].RecordedAt.Before(windowStart) {
+			sum -= weights[start].WeightKg
+			start++
+		}
+		averages[i] = sum / float64(i-start+1)
+	}
+
+	return averages
+}
+
+// SmoothedTrend returns the exponentially smoothed trend at each reading.
+// Each calendar day since the previous reading moves the trend by smoothing
+// of the remaining distance, so gaps in logging don't slow it down. Readings
+// must be in ascending order.
+func SmoothedTrend(weights []Weight, smoothing float64, loc *time.Location) []float64 {
+	trend := make([]float64, len(weights))
+	if len(weights) == 0 {
+		return trend
+	}
+
+	trend[0] = weights[0].WeightKg
+	prevDay := StartOfDay(weights[0].RecordedAt.In(loc))
+	for i := 1; i < len(weights); i++ {
+		day := StartOfDay(weights[i].RecordedAt.In(loc))
+		days := math.Max(1, math.Round(day.Sub(prevDay).Hours()/24))
+		factor := 1 - math.Pow(1-smoothing, days)
+		trend[i] = trend[i-1] + factor*(weights[i].WeightKg-trend[i-1])
+		prevDay = day
+	}
+
+	return trend
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// readings returns one reading per entry, each hours after start.
+func readings(start time.Time, hours []float64, kgs []float64) []Weight {
+	weights := make([]Weight, len(kgs))
+	for i, kg := range kgs {
+		weights[i] = Weight{WeightKg: kg, RecordedAt: start.Add(time.Duration(hours[i] * float64(time.Hour)))}
+	}
+	return weights
+}
+
+func TestFitTrend(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	// Exactly on a line falling 0.2 kg a day, given out of order
+	trend, ok := FitTrend(readings(start, []float64{48, 0, 24, 72}, []float64{89.6, 90, 89.8, 89.4}))
+	if !ok {
+		t.Fatal("no trend")
+	}
+	if !trend.Origin.Equal(start) || !approxEqual(trend.InterceptKg, 90) || !approxEqual(trend.SlopeKgPerDay, -0.2) {
+		t.Errorf("trend = %+v, want 90 kg at %v falling 0.2 kg a day", trend, start)
+	}
+	if got := trend.At(start.AddDate(0, 0, 10)); !approxEqual(got, 88) {
+		t.Errorf("At(+10 days) = %v, want 88", got)
+	}
+
+	// Noise around a rising line
+	trend, ok = FitTrend(readings(start, []float64{0, 24, 48, 72}, []float64{70, 70.4, 70.2, 70.6}))
+	if !ok || !approxEqual(trend.SlopeKgPerDay, 0.16) {
+		t.Errorf("noisy trend = %+v, want a slope of 0.16", trend)
+	}
+
+	for name, weights := range map[string][]Weight{
+		"no readings":  nil,
+		"one reading":  readings(start, []float64{0}, []float64{80}),
+		"same instant": readings(start, []float64{0, 0}, []float64{80, 81}),
+	} {
+		if trend, ok := FitTrend(weights); ok {
+			t.Errorf("%s: got trend %+v", name, trend)
+		}
+	}
+}
+
+func TestMovingAverage(t *testing.T) {
+	loc := mustLoadLocation(t, "America/New_York")
+	start := time.Date(2024, 1, 1, 7, 0, 0, 0, loc)
+
+	// Days 0, 1, 2, then a gap, then two readings on day 9 and one late on
+	// day 10 (still day 10 in New York, day 11 in UTC)
+	weights := readings(start,
+		[]float64{0, 24, 48, 216, 228, 255},
+		[]float64{80, 81, 82, 78, 80, 79})
+	got := MovingAverage(weights, 3, loc)
+	want := []float64{80, 80.5, 81, 78, 79, 79}
+	for i := range want {
+		if !approxEqual(got[i], want[i]) {
+			t.Errorf("average %d = %v, want %v (all %v)", i, got[i], want[i], got)
+		}
+	}
+
+	if got := MovingAverage(nil, MovingAverageDays, loc); len(got) != 0 {
+		t.Errorf("no readings: got %v", got)
+	}
+}
+
+func TestSmoothedTrend(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	// A gap of two days moves the trend as far as two daily readings would
+	weights := readings(start, []float64{0, 24, 72}, []float64{80, 90, 90})
+	got := SmoothedTrend(weights, 0.5, time.UTC)
+	want := []float64{80, 85, 88.75}
+	for i := range want {
+		if !approxEqual(got[i], want[i]) {
+			t.Errorf("trend %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	return loc
+}
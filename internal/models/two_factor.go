@@ -0,0 +1,289 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"weight-tracker/internal/totp"
+)
+
+const (
+	// RecoveryCodeCount is how many recovery codes are issued at a time.
+	RecoveryCodeCount = 10
+	// LoginChallengeTTL is how long the second login step may take.
+	LoginChallengeTTL = 5 * time.Minute
+
+	// recoveryCodeBytes gives recovery codes 40 bits of randomness; they are
+	// only accepted after the password and within the login throttle.
+	recoveryCodeBytes = 5
+)
+
+var (
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrLoginChallenge       = errors.New("login challenge expired")
+)
+
+// TwoFactor is a user's TOTP enrolment.
+type TwoFactor struct {
+	UserID       int
+	Secret       string // Base32, as shown to the user's authenticator app
+	LastUsedStep int64  // Time step of the last accepted code, so it can't be replayed
+	CreatedAt    time.Time
+	EnabledAt    *time.Time // Nil until confirmed with a first code
+}
+
+// IsEnabled reports whether logins must pass the TOTP step.
+func (t *TwoFactor) IsEnabled() bool {
+	return t.EnabledAt != nil
+}
+
+type TwoFactorRepository struct {
+	db *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+// Get returns the user's enrolment, or sql.ErrNoRows if they have none.
+func (r *TwoFactorRepository) Get(userID int) (*TwoFactor, error) {
+	var t TwoFactor
+	var enabledAt sql.NullTime
+	err := r.db.QueryRow(`SELECT user_id, secret, last_used_step, created_at, enabled_at
+                          FROM totp_secrets WHERE user_id = ?`, userID).
+		Scan(&t.UserID, &t.Secret, &t.LastUsedStep, &t.CreatedAt, &enabledAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledAt.Valid {
+		t.EnabledAt = &enabledAt.Time
+	}
+	return &t, nil
+}
+
+// IsEnabled reports whether the user has confirmed two-factor authentication.
+func (r *TwoFactorRepository) IsEnabled(userID int) (bool, error) {
+	t, err := r.Get(userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return t.IsEnabled(), nil
+}
+
+// BeginEnrolment gives the user a new secret that takes effect once Enable
+// confirms it, replacing any earlier unconfirmed one.
+func (r *TwoFactorRepository) BeginEnrolment(userID int) (*TwoFactor, error) {
+	if enabled, err := r.IsEnabled(userID); err != nil {
+		return nil, err
+	} else if enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	t := &TwoFactor{UserID: userID, Secret: secret, CreatedAt: time.Now().UTC()}
+	_, err = r.db.Exec(`INSERT INTO totp_secrets (user_id, secret, created_at) VALUES (?, ?, ?)
+                        ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret,
+                        last_used_step = 0, created_at = excluded.created_at, enabled_at = NULL`,
+		t.UserID, t.Secret, t.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save secret: %w", err)
+	}
+	return t, nil
+}
+
+// Enable confirms a pending enrolment with the first code from the user's app
+// and returns a fresh set of recovery codes. The codes are only stored
+// hashed, so they can't be shown again.
+func (r *TwoFactorRepository) Enable(userID int, code string, now time.Time) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var secret string
+	err = tx.QueryRow(`SELECT secret FROM totp_secrets WHERE user_id = ? AND enabled_at IS NULL`, userID).Scan(&secret)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("no two-factor enrolment in progress")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := totp.Validate(secret, code, now)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	if _, err := tx.Exec(`UPDATE totp_secrets SET enabled_at = ?, last_used_step = ? WHERE user_id = ?`,
+		now.UTC(), step, userID); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// Verify checks a code from the user's authenticator app or one of their
+// unused recovery codes. TOTP codes are refused if they are no newer than
+// the last one accepted, and recovery codes are used up. It reports whether
+// a recovery code was used, or ErrInvalidTwoFactorCode.
+func (r *TwoFactorRepository) Verify(userID int, code string, now time.Time) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var secret string
+	var lastStep int64
+	err = tx.QueryRow(`SELECT secret, last_used_step FROM totp_secrets WHERE user_id = ? AND enabled_at IS NOT NULL`,
+		userID).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return false, ErrInvalidTwoFactorCode
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := totp.Validate(secret, code, now); ok {
+		if step <= lastStep {
+			return false, ErrInvalidTwoFactorCode
+		}
+		if _, err := tx.Exec(`UPDATE totp_secrets SET last_used_step = ? WHERE user_id = ?`, step, userID); err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+
+	result, err := tx.Exec(`UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		now.UTC(), userID, hashToken(normalizeCode(code)))
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return false, err
+	} else if n == 0 {
+		return false, ErrInvalidTwoFactorCode
+	}
+	return true, tx.Commit()
+}
+
+// Disable turns two-factor authentication off and discards the recovery codes.
+func (r *TwoFactorRepository) Disable(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM totp_secrets WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with a new set.
+func (r *TwoFactorRepository) RegenerateRecoveryCodes(userID int) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit()
+}
+
+// RemainingRecoveryCodes counts the user's unused recovery codes.
+func (r *TwoFactorRepository) RemainingRecoveryCodes(userID int) (int, error) {
+	var n int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&n)
+	return n, err
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code, err := generateCode(recoveryCodeBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`,
+			userID, hashToken(normalizeCode(code))); err != nil {
+			return nil, fmt.Errorf("failed to save recovery code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// CreateLoginChallenge records that the user passed the password step and
+// returns the token that lets them complete the login with a second factor.
+func (r *TwoFactorRepository) CreateLoginChallenge(userID int) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate login challenge: %w", err)
+	}
+
+	_, err = r.db.Exec(`INSERT INTO login_challenges (user_id, token_hash, expires_at) VALUES (?, ?, ?)`,
+		userID, hashToken(token), time.Now().UTC().Add(LoginChallengeTTL))
+	if err != nil {
+		return "", fmt.Errorf("failed to create login challenge: %w", err)
+	}
+	return token, nil
+}
+
+// GetLoginChallenge returns the user a login challenge belongs to, or
+// ErrLoginChallenge if it is unknown or has expired.
+func (r *TwoFactorRepository) GetLoginChallenge(token string) (int, error) {
+	var userID int
+	var expiresAt time.Time
+	err := r.db.QueryRow(`SELECT user_id, expires_at FROM login_challenges WHERE token_hash = ?`, hashToken(token)).
+		Scan(&userID, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return 0, ErrLoginChallenge
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// DeleteLoginChallenge ends a login challenge once it has been used.
+func (r *TwoFactorRepository) DeleteLoginChallenge(token string) error {
+	_, err := r.db.Exec(`DELETE FROM login_challenges WHERE token_hash = ?`, hashToken(token))
+	return err
+}
+
+// PurgeLoginChallenges removes expired login challenges.
+func (r *TwoFactorRepository) PurgeLoginChallenges(now time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM login_challenges WHERE expires_at < ?`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
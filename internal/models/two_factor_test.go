@@ -0,0 +1,121 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"weight-tracker/internal/totp"
+)
+
+func mustGenerateCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := totp.Generate(secret, at)
+	if err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	return code
+}
+
+// wrongCode returns a code that differs from code in every digit.
+func wrongCode(code string) string {
+	b := []byte(code)
+	for i := range b {
+		b[i] = '0' + (b[i]-'0'+1)%10
+	}
+	return string(b)
+}
+
+func TestTwoFactorEnrolment(t *testing.T) {
+	repo := NewTwoFactorRepository(newTestDB(t))
+	now := time.Now()
+
+	enrolment, err := repo.BeginEnrolment(1)
+	if err != nil {
+		t.Fatalf("begin enrolment: %v", err)
+	}
+	if enabled, _ := repo.IsEnabled(1); enabled {
+		t.Fatal("enabled before the first code was confirmed")
+	}
+
+	if _, err := repo.Enable(1, wrongCode(mustGenerateCode(t, enrolment.Secret, now)), now); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("wrong first code: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	codes, err := repo.Enable(1, mustGenerateCode(t, enrolment.Secret, now), now)
+	if err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), RecoveryCodeCount)
+	}
+	if enabled, _ := repo.IsEnabled(1); !enabled {
+		t.Fatal("not enabled after confirming")
+	}
+	if _, err := repo.BeginEnrolment(1); !errors.Is(err, ErrTwoFactorEnabled) {
+		t.Errorf("re-enrolment: err = %v, want ErrTwoFactorEnabled", err)
+	}
+
+	// The confirming code can't be replayed, the next period's code works once
+	if _, err := repo.Verify(1, mustGenerateCode(t, enrolment.Secret, now), now); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("replayed code: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	next := now.Add(totp.Period)
+	if recovery, err := repo.Verify(1, mustGenerateCode(t, enrolment.Secret, next), next); err != nil || recovery {
+		t.Errorf("next code = %v, %v; want false, nil", recovery, err)
+	}
+	if _, err := repo.Verify(1, mustGenerateCode(t, enrolment.Secret, next), next); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("reused code: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	// Recovery codes work once, however they are typed
+	typed := strings.ToLower(strings.ReplaceAll(codes[3], "-", ""))
+	if recovery, err := repo.Verify(1, typed, now); err != nil || !recovery {
+		t.Errorf("recovery code = %v, %v; want true, nil", recovery, err)
+	}
+	if _, err := repo.Verify(1, codes[3], now); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("reused recovery code: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	if n, _ := repo.RemainingRecoveryCodes(1); n != RecoveryCodeCount-1 {
+		t.Errorf("%d recovery codes left, want %d", n, RecoveryCodeCount-1)
+	}
+
+	// Another user's codes are no good
+	if _, err := repo.Verify(2, codes[4], now); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("other user's code: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+
+	if err := repo.Disable(1); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if enabled, _ := repo.IsEnabled(1); enabled {
+		t.Error("still enabled after disabling")
+	}
+	if n, _ := repo.RemainingRecoveryCodes(1); n != 0 {
+		t.Errorf("%d recovery codes left after disabling", n)
+	}
+}
+
+func TestLoginChallenge(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewTwoFactorRepository(db)
+
+	token, err := repo.CreateLoginChallenge(1)
+	if err != nil {
+		t.Fatalf("create challenge: %v", err)
+	}
+	if userID, err := repo.GetLoginChallenge(token); err != nil || userID != 1 {
+		t.Fatalf("challenge = %d, %v; want 1, nil", userID, err)
+	}
+
+	if _, err := db.Exec(`UPDATE login_challenges SET expires_at = ?`, time.Now().Add(-time.Second).UTC()); err != nil {
+		t.Fatalf("expire challenge: %v", err)
+	}
+	if _, err := repo.GetLoginChallenge(token); !errors.Is(err, ErrLoginChallenge) {
+		t.Errorf("expired challenge: err = %v, want ErrLoginChallenge", err)
+	}
+	if n, err := repo.PurgeLoginChallenges(time.Now()); err != nil || n != 1 {
+		t.Errorf("purge = %d, %v; want 1, nil", n, err)
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"fmt"
+	"math"
+)
+
+// Display units. Weights are always stored in kilograms.
+const (
+	UnitKg = "kg"
+	UnitLb = "lb"
+	UnitSt = "st" // stones and pounds
+)
+
+const (
+	kgPerLb      = 0.45359237
+	lbPerStone   = 14
+	kgPerStone   = kgPerLb * lbPerStone
+	weightFormat = "%.1f %s"
+)
+
+func ValidUnit(unit string) bool {
+	return unit == UnitKg || unit == UnitLb || unit == UnitSt
+}
+
+// ToKg converts a weight in unit to kilograms. Stones may be fractional.
+func ToKg(value float64, unit string) float64 {
+	switch unit {
+	case UnitLb:
+		return value * kgPerLb
+	case UnitSt:
+		return value * kgPerStone
+	default:
+		return value
+	}
+}
+
+// FromKg converts kilograms to unit, rounded for display: a tenth of a
+// kilogram or pound. Stones keep three decimals so they can still be split
+// into stones and pounds to a tenth of a pound.
+func FromKg(kg float64, unit string) float64 {
+	switch unit {
+	case UnitLb:
+		return round(kg/kgPerLb, 1)
+	case UnitSt:
+		return round(kg/kgPerStone, 3)
+	default:
+		return round(kg, 1)
+	}
+}
+
+// StonesAndPounds splits kilograms into whole stones and the remaining
+// pounds, rounded to a tenth.
+func StonesAndPounds(kg float64) (int, float64) {
+	pounds := round(kg/kgPerLb, 1)
+	stones := math.Floor(pounds / lbPerStone)
+	return int(stones), round(pounds-stones*lbPerStone, 1)
+}
+
+// FormatWeight renders kilograms in unit, e.g. "80.2 kg", "176.8 lb" or
+// "12 st 8.8 lb".
+func FormatWeight(kg float64, unit string) string {
+	if unit == UnitSt {
+		stones, pounds := StonesAndPounds(kg)
+		return fmt.Sprintf("%d st %.1f lb", stones, pounds)
+	}
+	return fmt.Sprintf(weightFormat, FromKg(kg, unit), unit)
+}
+
+func round(value float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(value*p) / p
+}
@@ -0,0 +1,69 @@
+package models
+
+import "testing"
+
+func TestUnitRoundTrip(t *testing.T) {
+	tests := []struct {
+		value float64
+		unit  string
+		kg    float64
+	}{
+		{80.4, UnitKg, 80.4},
+		{176.4, UnitLb, 80.013694068},
+		{12.6, UnitSt, 80.013694068},
+		{12.625, UnitSt, 80.1724513975},
+	}
+	for _, tt := range tests {
+		kg := ToKg(tt.value, tt.unit)
+		if !approxEqual(kg, tt.kg) {
+			t.Errorf("ToKg(%v, %s) = %v, want %v", tt.value, tt.unit, kg, tt.kg)
+		}
+		if back := FromKg(kg, tt.unit); back != tt.value {
+			t.Errorf("FromKg(ToKg(%v, %s)) = %v", tt.value, tt.unit, back)
+		}
+	}
+
+	// Display values are rounded
+	for _, tt := range []struct {
+		unit string
+		want float64
+	}{
+		{UnitKg, 80.2},
+		{UnitLb, 176.8},
+		{UnitSt, 12.628},
+	} {
+		if got := FromKg(80.19, tt.unit); got != tt.want {
+			t.Errorf("FromKg(80.19, %s) = %v, want %v", tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestStonesAndPounds(t *testing.T) {
+	tests := []struct {
+		lb     float64
+		stones int
+		pounds float64
+		format string
+	}{
+		{176.4, 12, 8.4, "12 st 8.4 lb"},
+		{168, 12, 0, "12 st 0.0 lb"},
+		// Pounds that round up to a whole stone carry over
+		{195.96, 14, 0, "14 st 0.0 lb"},
+		{195.94, 13, 13.9, "13 st 13.9 lb"},
+		{0.04, 0, 0, "0 st 0.0 lb"},
+	}
+	for _, tt := range tests {
+		kg := ToKg(tt.lb, UnitLb)
+		stones, pounds := StonesAndPounds(kg)
+		if stones != tt.stones || pounds != tt.pounds {
+			t.Errorf("StonesAndPounds(%v lb) = %d st %v lb, want %d st %v lb", tt.lb, stones, pounds, tt.stones, tt.pounds)
+		}
+		if got := FormatWeight(kg, UnitSt); got != tt.format {
+			t.Errorf("FormatWeight(%v lb) = %q, want %q", tt.lb, got, tt.format)
+		}
+	}
+
+	if got := FormatWeight(80.19, UnitLb); got != "176.8 lb" {
+		t.Errorf("FormatWeight in pounds = %q", got)
+	}
+}
@@ -9,11 +9,12 @@ import (
 )
 
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"` // Don't include in JSON
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"` // Don't include in JSON
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DeleteAfter  *time.Time `json:"-"` // Set while the account is scheduled for deletion
 }
 
 type UserRepository struct {
@@ -24,6 +25,17 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// MinPasswordLength is the shortest password accepted for an account.
+const MinPasswordLength = 6
+
+// ValidatePassword applies the rules every new password must meet.
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	return nil
+}
+
 func (r *UserRepository) Create(username, password string) (*User, error) {
 	// Validate inputs
 	if username == "" || password == "" {
@@ -32,17 +44,14 @@ func (r *UserRepository) Create(username, password string) (*User, error) {
 	if len(username) < 3 {
 		return nil, fmt.Errorf("username must be at least 3 characters")
 	}
-	if len(password) < 6 {
-		return nil, fmt.Errorf("password must be at least 6 characters")
-	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
+		return nil, err
 	}
 
 	query := `INSERT INTO users (username, password_hash) VALUES (?, ?)`
-	result, err := r.db.Exec(query, username, string(hashedPassword))
+	result, err := r.db.Exec(query, username, hashedPassword)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
@@ -63,32 +72,142 @@ func (r *UserRepository) Create(username, password string) (*User, error) {
 }
 
 func (r *UserRepository) GetByUsername(username string) (*User, error) {
-	query := `SELECT id, username, password_hash, created_at, updated_at FROM users WHERE username = ?`
-	row := r.db.QueryRow(query, username)
+	query := `SELECT id, username, password_hash, created_at, updated_at, delete_after FROM users WHERE username = ?`
+	return scanUser(r.db.QueryRow(query, username))
+}
 
-	var user User
-	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+func (r *UserRepository) GetByID(id int) (*User, error) {
+	query := `SELECT id, username, password_hash, created_at, updated_at, delete_after FROM users WHERE id = ?`
+	return scanUser(r.db.QueryRow(query, id))
+}
+
+func (r *UserRepository) VerifyPassword(user *User, password string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	return err == nil
+}
+
+// UpdatePassword replaces the user's password after checking it against
+// ValidatePassword.
+func (r *UserRepository) UpdatePassword(id int, password string) error {
+	hash, err := hashPassword(password)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return &user, nil
+	_, err = r.db.Exec(`UPDATE users SET password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, hash, id)
+	return err
 }
 
-func (r *UserRepository) GetByID(id int) (*User, error) {
-	query := `SELECT id, username, password_hash, created_at, updated_at FROM users WHERE id = ?`
-	row := r.db.QueryRow(query, id)
+func hashPassword(password string) (string, error) {
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
 
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// IsScheduledForDeletion reports whether the account is disabled pending
+// deletion. Such accounts can't be used until the deletion is cancelled.
+func (u *User) IsScheduledForDeletion() bool {
+	return u.DeleteAfter != nil
+}
+
+// ScheduleDeletion disables the account and logs it out everywhere. Its data
+// is kept until deleteAfter so the deletion can still be cancelled.
+func (r *UserRepository) ScheduleDeletion(id int, deleteAfter time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET delete_after = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		deleteAfter.UTC(), id); err != nil {
+		return fmt.Errorf("failed to schedule deletion: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to end sessions: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// CancelDeletion re-enables an account scheduled for deletion.
+func (r *UserRepository) CancelDeletion(id int) error {
+	_, err := r.db.Exec(`UPDATE users SET delete_after = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	return err
+}
+
+// userTables lists every table with per-user rows.
+var userTables = []string{"weights", "settings", "goals", "sessions", "api_tokens", "password_resets",
+	"totp_secrets", "recovery_codes", "login_challenges"}
+
+// Delete removes the user and all of their data in one transaction. Rows are
+// deleted from each table explicitly instead of relying on ON DELETE CASCADE,
+// which SQLite only honours on connections with foreign keys enabled.
+func (r *UserRepository) Delete(id int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range userTables {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// PurgeScheduled deletes every account whose grace period ended before now
+// and returns how many were removed.
+func (r *UserRepository) PurgeScheduled(now time.Time) (int, error) {
+	rows, err := r.db.Query(`SELECT id FROM users WHERE delete_after IS NOT NULL AND delete_after <= ?`, now.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := r.Delete(id); err != nil {
+			return i, fmt.Errorf("user %d: %w", id, err)
+		}
+	}
+	return len(ids), nil
+}
+
+func scanUser(row rowScanner) (*User, error) {
 	var user User
-	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+	var deleteAfter sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt, &deleteAfter)
 	if err != nil {
 		return nil, err
 	}
 
+	if deleteAfter.Valid {
+		user.DeleteAfter = &deleteAfter.Time
+	}
 	return &user, nil
 }
-
-func (r *UserRepository) VerifyPassword(user *User, password string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
-	return err == nil
-}
\ No newline at end of file
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// seedUserData gives the user a row in every per-user table.
+func seedUserData(t *testing.T, db *sql.DB, userID int) {
+	t.Helper()
+
+	mustCreateWeight(t, NewWeightRepository(db), userID, 80, time.Now().AddDate(0, 0, -1))
+	if err := NewSettingsRepository(db).Save(userID, DefaultSettings()); err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+	if err := NewGoalRepository(db).Create(&Goal{UserID: userID, StartWeightKg: 80, TargetWeightKg: 75}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+	if _, err := NewSessionRepository(db).Create(userID, "test", "127.0.0.1"); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if _, err := NewAPITokenRepository(db).Create(userID, "test", ScopeRead); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+}
+
+// userRowCount counts the user's rows across the users table and userTables.
+func userRowCount(t *testing.T, db *sql.DB, userID int) int {
+	t.Helper()
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users WHERE id = ?`, userID).Scan(&total); err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	for _, table := range userTables {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE user_id = ?`, userID).Scan(&n); err != nil {
+			t.Fatalf("count %s: %v", table, err)
+		}
+		total += n
+	}
+	return total
+}
+
+func TestDeleteRemovesAllData(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewUserRepository(db)
+	seedUserData(t, db, 1)
+	seedUserData(t, db, 2)
+	others := userRowCount(t, db, 2)
+
+	if err := repo.Delete(1); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if n := userRowCount(t, db, 1); n != 0 {
+		t.Errorf("%d rows left for the deleted user", n)
+	}
+	if n := userRowCount(t, db, 2); n != others {
+		t.Errorf("other user has %d rows, want %d", n, others)
+	}
+}
+
+func TestScheduledDeletion(t *testing.T) {
+	db := newTestDB(t)
+	repo := NewUserRepository(db)
+	seedUserData(t, db, 1)
+	seedUserData(t, db, 2)
+
+	now := time.Now()
+	if err := repo.ScheduleDeletion(1, now.Add(time.Hour)); err != nil {
+		t.Fatalf("schedule user 1: %v", err)
+	}
+	if err := repo.ScheduleDeletion(2, now.Add(time.Hour)); err != nil {
+		t.Fatalf("schedule user 2: %v", err)
+	}
+
+	user, err := repo.GetByID(1)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if !user.IsScheduledForDeletion() {
+		t.Error("user 1 should be scheduled for deletion")
+	}
+	if sessions, _ := NewSessionRepository(db).ListByUser(1); len(sessions) != 0 {
+		t.Errorf("%d sessions left after scheduling deletion", len(sessions))
+	}
+
+	if err := repo.CancelDeletion(2); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	// Nothing is due yet
+	if n, err := repo.PurgeScheduled(now); err != nil || n != 0 {
+		t.Fatalf("early purge = %d, %v; want 0, nil", n, err)
+	}
+
+	n, err := repo.PurgeScheduled(now.Add(2 * time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("purge = %d, %v; want 1, nil", n, err)
+	}
+	if n := userRowCount(t, db, 1); n != 0 {
+		t.Errorf("%d rows left for the purged user", n)
+	}
+	if _, err := repo.GetByID(2); err != nil {
+		t.Errorf("restored user was purged: %v", err)
+	}
+}
@@ -6,6 +6,24 @@ import (
 	"time"
 )
 
+// Accepted range for a single reading and the longest note we store.
+const (
+	MinWeightKg    = 20
+	MaxWeightKg    = 500
+	MaxNotesLength = 500
+
+	// maxFutureSkew tolerates clients whose clocks run slightly ahead.
+	maxFutureSkew = 5 * time.Minute
+)
+
+// ValidateRecordedAt rejects readings dated in the future.
+func ValidateRecordedAt(recordedAt time.Time) error {
+	if recordedAt.After(time.Now().Add(maxFutureSkew)) {
+		return fmt.Errorf("date can't be in the future")
+	}
+	return nil
+}
+
 type Weight struct {
 	ID         int       `json:"id"`
 	UserID     int       `json:"user_id"`
@@ -26,7 +44,7 @@ func NewWeightRepository(db *sql.DB) *WeightRepository {
 
 func (r *WeightRepository) Create(weight *Weight) error {
 	query := `INSERT INTO weights (user_id, weight_kg, recorded_at, notes) VALUES (?, ?, ?, ?)`
-	result, err := r.db.Exec(query, weight.UserID, weight.WeightKg, weight.RecordedAt, weight.Notes)
+	result, err := r.db.Exec(query, weight.UserID, weight.WeightKg, weight.RecordedAt.UTC(), weight.Notes)
 	if err != nil {
 		return err
 	}
@@ -40,10 +58,10 @@ func (r *WeightRepository) Create(weight *Weight) error {
 	return nil
 }
 
-func (r *WeightRepository) GetByDate(userID int, date string) (*Weight, error) {
+func (r *WeightRepository) GetByID(id, userID int) (*Weight, error) {
 	query := `SELECT id, user_id, weight_kg, recorded_at, notes, created_at, updated_at
-              FROM weights WHERE user_id = ? AND DATE(recorded_at) = DATE(?)`
-	row := r.db.QueryRow(query, userID, date)
+              FROM weights WHERE id = ? AND user_id = ?`
+	row := r.db.QueryRow(query, id, userID)
 
 	var weight Weight
 	err := row.Scan(&weight.ID, &weight.UserID, &weight.WeightKg, &weight.RecordedAt,
@@ -55,50 +73,139 @@ func (r *WeightRepository) GetByDate(userID int, date string) (*Weight, error) {
 	return &weight, nil
 }
 
+// GetByDate returns the earliest entry recorded on the calendar day of date,
+// with the day's boundaries taken in date's location.
+func (r *WeightRepository) GetByDate(userID int, date time.Time) (*Weight, error) {
+	start := StartOfDay(date)
+	end := start.AddDate(0, 0, 1)
+
+	query := `SELECT id, user_id, weight_kg, recorded_at, notes, created_at, updated_at
+              FROM weights WHERE user_id = ? AND recorded_at >= ? AND recorded_at < ?
+              ORDER BY recorded_at ASC LIMIT 1`
+	row := r.db.QueryRow(query, userID, start.UTC(), end.UTC())
+
+	var weight Weight
+	err := row.Scan(&weight.ID, &weight.UserID, &weight.WeightKg, &weight.RecordedAt,
+		&weight.Notes, &weight.CreatedAt, &weight.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &weight, nil
+}
+
+// SaveForDay stores weight as the user's entry for the day of its RecordedAt,
+// which may be in the past. The day is taken in RecordedAt's location. If that day already has an entry it is overwritten
+// and weight takes over its ID; the returned bool reports whether a new row
+// was created.
+func (r *WeightRepository) SaveForDay(weight *Weight) (bool, error) {
+	existing, err := r.GetByDate(weight.UserID, weight.RecordedAt)
+	if err == nil && existing != nil {
+		existing.WeightKg = weight.WeightKg
+		existing.RecordedAt = weight.RecordedAt
+		existing.Notes = weight.Notes
+		if err := r.Update(existing); err != nil {
+			return false, err
+		}
+		*weight = *existing
+		return false, nil
+	}
+
+	if err := r.Create(weight); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (r *WeightRepository) Update(weight *Weight) error {
 	query := `UPDATE weights SET weight_kg = ?, recorded_at = ?, notes = ?, updated_at = CURRENT_TIMESTAMP
               WHERE id = ? AND user_id = ?`
-	_, err := r.db.Exec(query, weight.WeightKg, weight.RecordedAt, weight.Notes, weight.ID, weight.UserID)
+	_, err := r.db.Exec(query, weight.WeightKg, weight.RecordedAt.UTC(), weight.Notes, weight.ID, weight.UserID)
 	return err
 }
 
 func (r *WeightRepository) GetRecent(userID int, limit int) ([]Weight, error) {
 	query := `SELECT id, user_id, weight_kg, recorded_at, notes, created_at, updated_at
               FROM weights WHERE user_id = ? ORDER BY recorded_at DESC LIMIT ?`
-	rows, err := r.db.Query(query, userID, limit)
+	return r.queryWeights(query, userID, limit)
+}
+
+// List returns a page of the user's entries, newest first.
+func (r *WeightRepository) List(userID, limit, offset int) ([]Weight, error) {
+	query := `SELECT id, user_id, weight_kg, recorded_at, notes, created_at, updated_at
+              FROM weights WHERE user_id = ? ORDER BY recorded_at DESC LIMIT ? OFFSET ?`
+	return r.queryWeights(query, userID, limit, offset)
+}
+
+func (r *WeightRepository) Count(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM weights WHERE user_id = ?`, userID).Scan(&count)
+	return count, err
+}
+
+func (r *WeightRepository) Delete(id, userID int) error {
+	query := `DELETE FROM weights WHERE id = ? AND user_id = ?`
+	_, err := r.db.Exec(query, id, userID)
+	return err
+}
+
+// GetRange returns the user's entries recorded in [from, to), oldest first.
+// A zero from or to leaves that end of the range open.
+func (r *WeightRepository) GetRange(userID int, from, to time.Time) ([]Weight, error) {
+	where, args := rangeFilter(userID, from, to)
+	query := `SELECT id, user_id, weight_kg, recorded_at, notes, created_at, updated_at
+              FROM weights WHERE ` + where + ` ORDER BY recorded_at ASC`
+	return r.queryWeights(query, args...)
+}
+
+// rangeFilter builds the WHERE clause for the user's readings in [from, to).
+// Times are stored in UTC, so the bounds compare correctly as stored values.
+func rangeFilter(userID int, from, to time.Time) (string, []interface{}) {
+	where := `user_id = ?`
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		where += ` AND recorded_at >= ?`
+		args = append(args, from.UTC())
+	}
+	if !to.IsZero() {
+		where += ` AND recorded_at < ?`
+		args = append(args, to.UTC())
+	}
+	return where, args
+}
+
+// Each calls fn for every entry recorded in [from, to), oldest first,
+// reading rows from the cursor one at a time instead of loading them all.
+// A zero from or to leaves that end of the range open. Iteration stops at the
+// first error fn returns.
+func (r *WeightRepository) Each(userID int, from, to time.Time, fn func(Weight) error) error {
+	where, args := rangeFilter(userID, from, to)
+	query := `SELECT id, user_id, weight_kg, recorded_at, notes, created_at, updated_at
+              FROM weights WHERE ` + where + ` ORDER BY recorded_at ASC`
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var weights []Weight
 	for rows.Next() {
 		var weight Weight
 		err := rows.Scan(&weight.ID, &weight.UserID, &weight.WeightKg, &weight.RecordedAt,
 			&weight.Notes, &weight.CreatedAt, &weight.UpdatedAt)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(weight); err != nil {
+			return err
 		}
-		weights = append(weights, weight)
 	}
 
-	return weights, nil
+	return rows.Err()
 }
 
-func (r *WeightRepository) Delete(id, userID int) error {
-	query := `DELETE FROM weights WHERE id = ? AND user_id = ?`
-	_, err := r.db.Exec(query, id, userID)
-	return err
-}
-
-func (r *WeightRepository) GetChartData(userID int, days int) ([]Weight, error) {
-	query := `SELECT id, user_id, weight_kg, recorded_at, notes, created_at, updated_at
-              FROM weights
-              WHERE user_id = ? AND recorded_at >= date('now', '-{} days')
-              ORDER BY recorded_at ASC`
-
-	// Use string formatting for the days parameter since it's a number
-	rows, err := r.db.Query(fmt.Sprintf(query, days), userID)
+func (r *WeightRepository) queryWeights(query string, args ...interface{}) ([]Weight, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -115,5 +222,5 @@ func (r *WeightRepository) GetChartData(userID int, days int) ([]Weight, error)
 		weights = append(weights, weight)
 	}
 
-	return weights, nil
-}
\ No newline at end of file
+	return weights, rows.Err()
+}
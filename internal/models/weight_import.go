@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// How an import treats a day that already has an entry.
+const (
+	DuplicateSkip      = "skip"
+	DuplicateOverwrite = "overwrite"
+	DuplicateKeep      = "keep"
+)
+
+// ValidDuplicateMode reports whether mode is a supported duplicate handling.
+func ValidDuplicateMode(mode string) bool {
+	switch mode {
+	case DuplicateSkip, DuplicateOverwrite, DuplicateKeep:
+		return true
+	}
+	return false
+}
+
+// ImportResult counts what an import did with its entries.
+type ImportResult struct {
+	Created     int
+	Overwritten int
+	Skipped     int
+}
+
+// Import saves the entries for the user in a single transaction: either all
+// of them are applied or none are. Entries are applied in order, so a day
+// that appears twice in the import counts as already having an entry the
+// second time. Days are taken in loc.
+func (r *WeightRepository) Import(userID int, weights []Weight, duplicates string, loc *time.Location) (*ImportResult, error) {
+	if !ValidDuplicateMode(duplicates) {
+		return nil, fmt.Errorf("invalid duplicate mode %q", duplicates)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{}
+	for i, weight := range weights {
+		if duplicates != DuplicateKeep {
+			start := StartOfDay(weight.RecordedAt.In(loc))
+			var existingID int
+			err := tx.QueryRow(`SELECT id FROM weights WHERE user_id = ? AND recorded_at >= ? AND recorded_at < ?
+                                ORDER BY recorded_at ASC LIMIT 1`,
+				userID, start.UTC(), start.AddDate(0, 0, 1).UTC()).Scan(&existingID)
+
+			switch {
+			case err == sql.ErrNoRows:
+			case err != nil:
+				return nil, fmt.Errorf("entry %d: %w", i+1, err)
+			case duplicates == DuplicateSkip:
+				result.Skipped++
+				continue
+			default:
+				_, err := tx.Exec(`UPDATE weights SET weight_kg = ?, recorded_at = ?, notes = ?, updated_at = CURRENT_TIMESTAMP
+                                   WHERE id = ? AND user_id = ?`,
+					weight.WeightKg, weight.RecordedAt.UTC(), weight.Notes, existingID, userID)
+				if err != nil {
+					return nil, fmt.Errorf("entry %d: %w", i+1, err)
+				}
+				result.Overwritten++
+				continue
+			}
+		}
+
+		_, err := tx.Exec(`INSERT INTO weights (user_id, weight_kg, recorded_at, notes) VALUES (?, ?, ?, ?)`,
+			userID, weight.WeightKg, weight.RecordedAt.UTC(), weight.Notes)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		result.Created++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,375 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// WeightSummary aggregates the days with readings in a time range. Each day
+// counts once, with its readings collapsed by the user's daily aggregation.
+type WeightSummary struct {
+	Days     int
+	Readings int
+	MeanKg   float64
+	// StdDevKg is the population standard deviation of the daily values.
+	StdDevKg float64
+	// SlopeKgPerDay is the least-squares rate of change; zero with fewer
+	// than two days.
+	SlopeKgPerDay float64
+}
+
+// Extreme is the value of a single day that was a high or low.
+type Extreme struct {
+	WeightKg   float64
+	RecordedAt time.Time
+}
+
+// Period is a named [Start, End) time range, such as a month.
+type Period struct {
+	Label string
+	Start time.Time
+	End   time.Time
+}
+
+// PeriodExtremes holds the highest and lowest days of a period.
+type PeriodExtremes struct {
+	Period
+	High Extreme
+	Low  Extreme
+}
+
+// zoneSpan is a stretch of time over which loc keeps one UTC offset.
+type zoneSpan struct {
+	start, end time.Time
+	offset     int // Seconds east of UTC
+}
+
+// zoneSpans splits [from, to) wherever loc's UTC offset changes, so SQL can
+// shift each reading into local time. Offsets are compared a day apart, so
+// two changes within one day would be missed; no zone does that.
+func zoneSpans(loc *time.Location, from, to time.Time) []zoneSpan {
+	var spans []zoneSpan
+	start := from
+	_, offset := from.In(loc).Zone()
+
+	for t := from; t.Before(to); {
+		next := t.Add(24 * time.Hour)
+		if next.After(to) {
+			next = to
+		}
+		if _, o := next.In(loc).Zone(); o == offset {
+			t = next
+			continue
+		}
+
+		// Narrow down to the second the offset changes
+		lo, hi := t.Unix(), next.Unix()
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			if _, o := time.Unix(mid, 0).In(loc).Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		change := time.Unix(hi, 0)
+		spans = append(spans, zoneSpan{start, change, offset})
+		start, t = change, change
+		_, offset = change.In(loc).Zone()
+	}
+
+	return append(spans, zoneSpan{start, to, offset})
+}
+
+// dailyReadings returns a CTE named daily with one row per day, as seen in
+// loc, that has readings in [from, to): the day as YYYY-MM-DD, the number of
+// readings and their aggregate as weight_kg. Statistics built on it count
+// each day once however many readings it has. A zero from or to leaves that
+// end of the range open.
+func (r *WeightRepository) dailyReadings(userID int, from, to time.Time, aggregation string, loc *time.Location) (string, []interface{}, error) {
+	// Open ends are bounded by the user's readings, to know which offsets apply
+	if from.IsZero() || to.IsZero() {
+		var first, last time.Time
+		err := r.db.QueryRow(`SELECT recorded_at FROM weights WHERE user_id = ? ORDER BY recorded_at ASC LIMIT 1`, userID).Scan(&first)
+		if err == nil {
+			err = r.db.QueryRow(`SELECT recorded_at FROM weights WHERE user_id = ? ORDER BY recorded_at DESC LIMIT 1`, userID).Scan(&last)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			first, last = time.Now(), time.Now()
+		} else if err != nil {
+			return "", nil, err
+		}
+		if from.IsZero() {
+			from = first
+		}
+		if to.IsZero() {
+			to = last.Add(time.Second)
+		}
+	}
+
+	spans := zoneSpans(loc, from, to)
+	values := make([]string, len(spans))
+	args := make([]interface{}, 0, len(spans)*3+3)
+	for i, span := range spans {
+		values[i] = "(?, ?, ?)"
+		args = append(args, span.start.UTC(), span.end.UTC(), span.offset)
+	}
+	where, whereArgs := rangeFilter(userID, from, to)
+	args = append(args, whereArgs...)
+
+	value := `MAX(CASE WHEN last_rank = 1 THEN weight_kg END)`
+	switch aggregation {
+	case AggregateFirst:
+		value = `MAX(CASE WHEN first_rank = 1 THEN weight_kg END)`
+	case AggregateMin:
+		value = `MIN(weight_kg)`
+	case AggregateMean:
+		value = `AVG(weight_kg)`
+	}
+
+	cte := `zones (start_at, end_at, utc_offset) AS (VALUES ` + strings.Join(values, ", ") + `),
+            local AS (
+                SELECT id, weight_kg, recorded_at, date(recorded_at, utc_offset || ' seconds') AS day
+                FROM weights JOIN zones ON recorded_at >= start_at AND recorded_at < end_at
+                WHERE ` + where + `
+            ),
+            day_ranks AS (
+                SELECT weight_kg, day,
+                       ROW_NUMBER() OVER (PARTITION BY day ORDER BY recorded_at ASC, id ASC) AS first_rank,
+                       ROW_NUMBER() OVER (PARTITION BY day ORDER BY recorded_at DESC, id DESC) AS last_rank
+                FROM local
+            ),
+            daily AS (
+                SELECT day, COUNT(*) AS readings, ` + value + ` AS weight_kg FROM day_ranks GROUP BY day
+            )`
+	return cte, args, nil
+}
+
+// Summarize aggregates the user's days in [from, to) in SQL, so the cost
+// doesn't grow with the amount of history returned. A zero from or to leaves
+// that end of the range open.
+func (r *WeightRepository) Summarize(userID int, from, to time.Time, aggregation string, loc *time.Location) (*WeightSummary, error) {
+	daily, args, err := r.dailyReadings(userID, from, to, aggregation, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Days are measured from the first day to keep the sums small
+	query := `WITH ` + daily + `,
+              points AS (
+                  SELECT readings, weight_kg AS y, julianday(day) - MIN(julianday(day)) OVER () AS x FROM daily
+              )
+              SELECT COUNT(*), COALESCE(SUM(readings), 0), COALESCE(AVG(y), 0), COALESCE(AVG(y * y), 0),
+                     COALESCE(SUM(x), 0), COALESCE(SUM(x * x), 0), COALESCE(SUM(x * y), 0), COALESCE(SUM(y), 0)
+              FROM points`
+
+	var summary WeightSummary
+	var meanSquare, sumX, sumXX, sumXY, sumY float64
+	err = r.db.QueryRow(query, args...).Scan(&summary.Days, &summary.Readings, &summary.MeanKg, &meanSquare,
+		&sumX, &sumXX, &sumXY, &sumY)
+	if err != nil {
+		return nil, err
+	}
+
+	if summary.Days > 0 {
+		summary.StdDevKg = math.Sqrt(math.Max(0, meanSquare-summary.MeanKg*summary.MeanKg))
+	}
+
+	n := float64(summary.Days)
+	if denominator := n*sumXX - sumX*sumX; summary.Days > 1 && denominator > 1e-9 {
+		summary.SlopeKgPerDay = (n*sumXY - sumX*sumY) / denominator
+	}
+
+	return &summary, nil
+}
+
+// Volatility returns the standard deviation of the change between
+// consecutive days in [from, to), and how many changes it is based on.
+// Readings within a day are aggregated first, so morning and evening
+// differences don't count.
+func (r *WeightRepository) Volatility(userID int, from, to time.Time, aggregation string, loc *time.Location) (float64, int, error) {
+	daily, args, err := r.dailyReadings(userID, from, to, aggregation, loc)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	query := `WITH ` + daily + `
+              SELECT COUNT(d), COALESCE(AVG(d), 0), COALESCE(AVG(d * d), 0) FROM (
+                  SELECT weight_kg - LAG(weight_kg) OVER (ORDER BY day) AS d FROM daily
+              )`
+
+	var count int
+	var mean, meanSquare float64
+	if err := r.db.QueryRow(query, args...).Scan(&count, &mean, &meanSquare); err != nil {
+		return 0, 0, err
+	}
+	if count == 0 {
+		return 0, 0, nil
+	}
+	return math.Sqrt(math.Max(0, meanSquare-mean*mean)), count, nil
+}
+
+// Extremes returns the highest and lowest day of each period that has any
+// readings, in the order given. Ties go to the earliest day. Periods should
+// start and end at midnight in loc; RecordedAt of each extreme is the start
+// of its day.
+func (r *WeightRepository) Extremes(userID int, periods []Period, aggregation string, loc *time.Location) ([]PeriodExtremes, error) {
+	if len(periods) == 0 {
+		return nil, nil
+	}
+
+	from, to := periods[0].Start, periods[0].End
+	for _, p := range periods[1:] {
+		if p.Start.Before(from) {
+			from = p.Start
+		}
+		if p.End.After(to) {
+			to = p.End
+		}
+	}
+	daily, args, err := r.dailyReadings(userID, from, to, aggregation, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, len(periods))
+	for i, p := range periods {
+		values[i] = "(?, ?, ?)"
+		args = append(args, i, p.Start.In(loc).Format("2006-01-02"), p.End.In(loc).Format("2006-01-02"))
+	}
+
+	query := `WITH ` + daily + `,
+              periods (idx, start_day, end_day) AS (VALUES ` + strings.Join(values, ", ") + `),
+              ranked AS (
+                  SELECT p.idx, d.weight_kg, d.day,
+                         ROW_NUMBER() OVER (PARTITION BY p.idx ORDER BY d.weight_kg DESC, d.day ASC) AS high_rank,
+                         ROW_NUMBER() OVER (PARTITION BY p.idx ORDER BY d.weight_kg ASC, d.day ASC) AS low_rank
+                  FROM periods p
+                  JOIN daily d ON d.day >= p.start_day AND d.day < p.end_day
+              )
+              SELECT idx, high_rank = 1, weight_kg, day FROM ranked
+              WHERE high_rank = 1 OR low_rank = 1
+              ORDER BY idx`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []PeriodExtremes
+	lastIdx := -1
+	for rows.Next() {
+		var idx int
+		var isHigh bool
+		var day string
+		var extreme Extreme
+		if err := rows.Scan(&idx, &isHigh, &extreme.WeightKg, &day); err != nil {
+			return nil, err
+		}
+		if extreme.RecordedAt, err = time.ParseInLocation("2006-01-02", day, loc); err != nil {
+			return nil, err
+		}
+
+		// A period with a single day has it as both high and low
+		if idx != lastIdx {
+			result = append(result, PeriodExtremes{Period: periods[idx], High: extreme, Low: extreme})
+			lastIdx = idx
+		}
+		if isHigh {
+			result[len(result)-1].High = extreme
+		} else {
+			result[len(result)-1].Low = extreme
+		}
+	}
+
+	return result, rows.Err()
+}
+
+// LatestDayBefore returns the last day with readings before the given time,
+// as seen in loc, collapsed into one value with the given aggregation.
+func (r *WeightRepository) LatestDayBefore(userID int, before time.Time, aggregation string, loc *time.Location) (*Weight, error) {
+	query := `SELECT recorded_at FROM weights WHERE user_id = ? AND recorded_at < ?
+              ORDER BY recorded_at DESC LIMIT 1`
+
+	var latest time.Time
+	if err := r.db.QueryRow(query, userID, before.UTC()).Scan(&latest); err != nil {
+		return nil, err
+	}
+
+	start := StartOfDay(latest.In(loc))
+	end := start.AddDate(0, 0, 1)
+	if end.After(before) {
+		end = before
+	}
+	readings, err := r.GetRange(userID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(readings) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	day := AggregateDaily(readings, aggregation, loc)[0]
+	return &day, nil
+}
+
+// LoggedDays returns each distinct day, as seen in loc, on which the user
+// logged a reading, oldest first. Days are grouped in SQL, so only one row per
+// day is read however many readings it has.
+func (r *WeightRepository) LoggedDays(userID int, loc *time.Location) ([]time.Time, error) {
+	daily, args, err := r.dailyReadings(userID, time.Time{}, time.Time{}, AggregateLast, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`WITH `+daily+` SELECT day FROM daily ORDER BY day`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []time.Time
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		start, err := time.ParseInLocation("2006-01-02", day, loc)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, start)
+	}
+
+	return days, rows.Err()
+}
+
+// LoggingStreaks returns the longest run of consecutive logged days and the
+// run that is still going as of today. A streak stays current until a full
+// day is missed, so not having logged yet today doesn't break it. days must
+// be distinct and ascending.
+func LoggingStreaks(days []time.Time, today time.Time) (longest, current int) {
+	run := 0
+	for i, day := range days {
+		if i > 0 && days[i-1].AddDate(0, 0, 1).Equal(day) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+
+	if n := len(days); n > 0 {
+		last := days[n-1]
+		if last.Equal(today) || last.AddDate(0, 0, 1).Equal(today) {
+			current = run
+		}
+	}
+	return longest, current
+}
@@ -0,0 +1,256 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// logDays records a morning and an evening reading, in loc, for each of the
+// given days starting at start.
+func logDays(t *testing.T, repo *WeightRepository, start time.Time, readings [][2]float64) {
+	t.Helper()
+
+	for i, day := range readings {
+		date := start.AddDate(0, 0, i)
+		mustCreateWeight(t, repo, 1, day[0], date.Add(7*time.Hour))
+		mustCreateWeight(t, repo, 1, day[1], date.Add(21*time.Hour))
+	}
+}
+
+func TestSummarizeAggregatesDays(t *testing.T) {
+	repo := NewWeightRepository(newTestDB(t))
+	loc := time.UTC
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, loc)
+
+	// Falling by 0.5 kg a day, always a kilogram heavier in the evening
+	logDays(t, repo, start, [][2]float64{{80, 81}, {79.5, 80.5}, {79, 80}, {78.5, 79.5}})
+
+	tests := []struct {
+		aggregation string
+		mean        float64
+	}{
+		{AggregateFirst, 79.25},
+		{AggregateLast, 80.25},
+		{AggregateMin, 79.25},
+		{AggregateMean, 79.75},
+	}
+
+	for _, tt := range tests {
+		summary, err := repo.Summarize(1, time.Time{}, time.Time{}, tt.aggregation, loc)
+		if err != nil {
+			t.Fatalf("%s: summarize: %v", tt.aggregation, err)
+		}
+		if summary.Days != 4 || summary.Readings != 8 {
+			t.Errorf("%s: %d days, %d readings; want 4 and 8", tt.aggregation, summary.Days, summary.Readings)
+		}
+		if !approxEqual(summary.MeanKg, tt.mean) {
+			t.Errorf("%s: mean = %v, want %v", tt.aggregation, summary.MeanKg, tt.mean)
+		}
+		if !approxEqual(summary.SlopeKgPerDay, -0.5) {
+			t.Errorf("%s: slope = %v, want -0.5", tt.aggregation, summary.SlopeKgPerDay)
+		}
+		if want := math.Sqrt(1.25 / 4); !approxEqual(summary.StdDevKg, want) {
+			t.Errorf("%s: std dev = %v, want %v", tt.aggregation, summary.StdDevKg, want)
+		}
+	}
+
+	window, err := repo.Summarize(1, start.AddDate(0, 0, 2), start.AddDate(0, 0, 4), AggregateMean, loc)
+	if err != nil {
+		t.Fatalf("summarize window: %v", err)
+	}
+	if window.Days != 2 || !approxEqual(window.MeanKg, 79.25) {
+		t.Errorf("window: %d days, mean %v; want 2 days averaging 79.25", window.Days, window.MeanKg)
+	}
+
+	empty, err := repo.Summarize(2, time.Time{}, time.Time{}, AggregateLast, loc)
+	if err != nil {
+		t.Fatalf("summarize without readings: %v", err)
+	}
+	if empty.Days != 0 || empty.Readings != 0 || empty.MeanKg != 0 {
+		t.Errorf("empty summary = %+v", empty)
+	}
+}
+
+func TestSummarizeUsesLocalDays(t *testing.T) {
+	repo := NewWeightRepository(newTestDB(t))
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Late-evening readings around the switch to daylight saving time on
+	// 10 March fall on the next day in UTC but not locally
+	for day := 8; day <= 12; day++ {
+		evening := time.Date(2024, 3, day, 22, 30, 0, 0, loc)
+		mustCreateWeight(t, repo, 1, 80, evening.Add(-14*time.Hour))
+		mustCreateWeight(t, repo, 1, 82, evening)
+	}
+
+	summary, err := repo.Summarize(1, time.Time{}, time.Time{}, AggregateMean, loc)
+	if err != nil {
+		t.Fatalf("summarize: %v", err)
+	}
+	if summary.Days != 5 || !approxEqual(summary.MeanKg, 81) || !approxEqual(summary.StdDevKg, 0) {
+		t.Errorf("summary = %+v, want 5 days of 81 kg", summary)
+	}
+
+	// Counted in UTC, each evening would start a day of its own
+	utc, err := repo.Summarize(1, time.Time{}, time.Time{}, AggregateMean, time.UTC)
+	if err != nil {
+		t.Fatalf("summarize in UTC: %v", err)
+	}
+	if utc.Days != 6 {
+		t.Errorf("UTC days = %d, want 6", utc.Days)
+	}
+}
+
+func TestVolatilityIgnoresIntradaySwings(t *testing.T) {
+	repo := NewWeightRepository(newTestDB(t))
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	logDays(t, repo, start, [][2]float64{{80, 82}, {80, 82}, {80, 82}, {81, 83}})
+
+	volatility, changes, err := repo.Volatility(1, time.Time{}, time.Time{}, AggregateLast, time.UTC)
+	if err != nil {
+		t.Fatalf("volatility: %v", err)
+	}
+	// Daily changes are 0, 0 and 1
+	if want := math.Sqrt(1.0/3 - 1.0/9); changes != 3 || !approxEqual(volatility, want) {
+		t.Errorf("volatility = %v over %d changes, want %v over 3", volatility, changes, want)
+	}
+
+	if _, changes, err := repo.Volatility(1, start, start.AddDate(0, 0, 1), AggregateLast, time.UTC); err != nil || changes != 0 {
+		t.Errorf("single day: %d changes, err %v; want none", changes, err)
+	}
+}
+
+func TestExtremes(t *testing.T) {
+	repo := NewWeightRepository(newTestDB(t))
+	loc := time.UTC
+	start := time.Date(2024, 1, 30, 0, 0, 0, 0, loc)
+	// 30 Jan to 3 Feb; the 1 Feb evening spike is outweighed by its morning
+	logDays(t, repo, start, [][2]float64{{80, 80.4}, {81, 81}, {79, 84}, {79, 79.2}, {80.5, 80}})
+
+	jan := Period{Label: "2024-01", Start: time.Date(2024, 1, 1, 0, 0, 0, 0, loc), End: time.Date(2024, 2, 1, 0, 0, 0, 0, loc)}
+	feb := Period{Label: "2024-02", Start: jan.End, End: time.Date(2024, 3, 1, 0, 0, 0, 0, loc)}
+	mar := Period{Label: "2024-03", Start: feb.End, End: time.Date(2024, 4, 1, 0, 0, 0, 0, loc)}
+
+	extremes, err := repo.Extremes(1, []Period{mar, feb, jan}, AggregateMin, loc)
+	if err != nil {
+		t.Fatalf("extremes: %v", err)
+	}
+	if len(extremes) != 2 || extremes[0].Label != "2024-02" || extremes[1].Label != "2024-01" {
+		t.Fatalf("extremes = %+v, want February then January", extremes)
+	}
+
+	day := func(d int, month time.Month) time.Time { return time.Date(2024, month, d, 0, 0, 0, 0, loc) }
+	tests := []struct {
+		got, want Extreme
+	}{
+		{extremes[0].High, Extreme{80, day(3, time.February)}},
+		// 1 and 2 Feb tie at 79 kg; the earlier day wins
+		{extremes[0].Low, Extreme{79, day(1, time.February)}},
+		{extremes[1].High, Extreme{81, day(31, time.January)}},
+		{extremes[1].Low, Extreme{80, day(30, time.January)}},
+	}
+	for _, tt := range tests {
+		if tt.got.WeightKg != tt.want.WeightKg || !tt.got.RecordedAt.Equal(tt.want.RecordedAt) {
+			t.Errorf("extreme = %v on %s, want %v on %s", tt.got.WeightKg, tt.got.RecordedAt.Format("2006-01-02"),
+				tt.want.WeightKg, tt.want.RecordedAt.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestZoneSpans(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	spans := zoneSpans(loc, from, to)
+	want := []zoneSpan{
+		{from, time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC), 0},
+		{time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC), time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC), 3600},
+		{time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC), to, 0},
+	}
+	if len(spans) != len(want) {
+		t.Fatalf("spans = %v, want %v", spans, want)
+	}
+	for i := range want {
+		if !spans[i].start.Equal(want[i].start) || !spans[i].end.Equal(want[i].end) || spans[i].offset != want[i].offset {
+			t.Errorf("span %d = %v, want %v", i, spans[i], want[i])
+		}
+	}
+
+	if spans := zoneSpans(time.UTC, from, to); len(spans) != 1 {
+		t.Errorf("UTC has %d spans, want 1", len(spans))
+	}
+}
+
+func TestLoggedDays(t *testing.T) {
+	repo := NewWeightRepository(newTestDB(t))
+	loc := mustLoadLocation(t, "America/New_York")
+	at := func(day, hour, min int) time.Time { return time.Date(2024, 3, day, hour, min, 0, 0, loc) }
+
+	if days, err := repo.LoggedDays(1, loc); err != nil || len(days) != 0 {
+		t.Fatalf("no readings: got %v (err %v)", days, err)
+	}
+
+	// Clocks go forward on March 10; late readings fall on the next UTC day
+	for _, recordedAt := range []time.Time{at(9, 23, 30), at(10, 7, 0), at(10, 21, 0), at(12, 0, 30), at(12, 23, 59)} {
+		mustCreateWeight(t, repo, 1, 80, recordedAt)
+	}
+	mustCreateWeight(t, repo, 2, 80, at(11, 8, 0))
+
+	days, err := repo.LoggedDays(1, loc)
+	if err != nil {
+		t.Fatalf("logged days: %v", err)
+	}
+	want := []time.Time{at(9, 0, 0), at(10, 0, 0), at(12, 0, 0)}
+	if len(days) != len(want) {
+		t.Fatalf("got %v, want %v", days, want)
+	}
+	for i := range want {
+		if !days[i].Equal(want[i]) || days[i].Location() != loc {
+			t.Errorf("day %d = %v, want %v", i, days[i], want[i])
+		}
+	}
+}
+
+func TestLoggingStreaks(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	days := func(ds ...int) []time.Time {
+		var result []time.Time
+		for _, d := range ds {
+			result = append(result, day(d))
+		}
+		return result
+	}
+
+	tests := []struct {
+		name             string
+		days             []time.Time
+		today            time.Time
+		longest, current int
+	}{
+		{"no days", nil, day(10), 0, 0},
+		{"logged today", days(8, 9, 10), day(10), 3, 3},
+		{"not yet today", days(8, 9), day(10), 2, 2},
+		{"missed a day", days(7, 8), day(10), 2, 0},
+		{"longest in the past", days(1, 2, 3, 4, 8, 9), day(10), 4, 2},
+		{"gap resets", days(1, 3, 5), day(5), 1, 1},
+	}
+
+	for _, tt := range tests {
+		longest, current := LoggingStreaks(tt.days, tt.today)
+		if longest != tt.longest || current != tt.current {
+			t.Errorf("%s: streaks = %d, %d; want %d, %d", tt.name, longest, current, tt.longest, tt.current)
+		}
+	}
+}
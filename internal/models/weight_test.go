@@ -0,0 +1,181 @@
+package models
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestDB returns a fresh database in a temporary directory with every
+// migration applied, opened the same way as the server opens it. Users 1 and
+// 2 exist so tests can add rows for them without tripping foreign keys.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db")+"?_time_format=sqlite&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob("../../migrations/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("find migrations: %v", err)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		if _, err := db.Exec(string(content)); err != nil {
+			t.Fatalf("apply %s: %v", file, err)
+		}
+	}
+
+	_, err = db.Exec(`INSERT INTO users (id, username, password_hash) VALUES (1, 'user1', ''), (2, 'user2', '')`)
+	if err != nil {
+		t.Fatalf("create users: %v", err)
+	}
+
+	return db
+}
+
+func mustCreateWeight(t *testing.T, repo *WeightRepository, userID int, kg float64, recordedAt time.Time) *Weight {
+	t.Helper()
+
+	weight := &Weight{UserID: userID, WeightKg: kg, RecordedAt: recordedAt}
+	if err := repo.Create(weight); err != nil {
+		t.Fatalf("create weight: %v", err)
+	}
+	return weight
+}
+
+func weightIDs(weights []Weight) []int {
+	ids := make([]int, len(weights))
+	for i, w := range weights {
+		ids[i] = w.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetRangeBoundaries(t *testing.T) {
+	repo := NewWeightRepository(newTestDB(t))
+
+	from := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)
+
+	mustCreateWeight(t, repo, 1, 80, from.Add(-time.Nanosecond))
+	atFrom := mustCreateWeight(t, repo, 1, 81, from)
+	justAfterFrom := mustCreateWeight(t, repo, 1, 82, from.Add(500*time.Millisecond))
+	beforeTo := mustCreateWeight(t, repo, 1, 83, to.Add(-time.Millisecond))
+	mustCreateWeight(t, repo, 1, 84, to)
+	mustCreateWeight(t, repo, 1, 85, to.Add(time.Second))
+	mustCreateWeight(t, repo, 2, 70, from.Add(time.Hour)) // another user
+
+	weights, err := repo.GetRange(1, from, to)
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+
+	want := []int{atFrom.ID, justAfterFrom.ID, beforeTo.ID}
+	if got := weightIDs(weights); !equalIDs(got, want) {
+		t.Errorf("GetRange = %v, want %v", got, want)
+	}
+}
+
+func TestGetRangeOpenEnds(t *testing.T) {
+	repo := NewWeightRepository(newTestDB(t))
+
+	base := time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC)
+	first := mustCreateWeight(t, repo, 1, 80, base.AddDate(-3, 0, 0))
+	second := mustCreateWeight(t, repo, 1, 81, base)
+	third := mustCreateWeight(t, repo, 1, 82, base.AddDate(0, 0, 1))
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []int
+	}{
+		{"open start", time.Time{}, base.AddDate(0, 0, 1), []int{first.ID, second.ID}},
+		{"open end", base, time.Time{}, []int{second.ID, third.ID}},
+		{"fully open", time.Time{}, time.Time{}, []int{first.ID, second.ID, third.ID}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weights, err := repo.GetRange(1, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("GetRange: %v", err)
+			}
+			if got := weightIDs(weights); !equalIDs(got, tt.want) {
+				t.Errorf("GetRange = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRangeNonUTCBounds(t *testing.T) {
+	repo := NewWeightRepository(newTestDB(t))
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	// Midnight in Tokyo is 15:00 UTC the day before
+	from := time.Date(2024, 3, 10, 0, 0, 0, 0, tokyo)
+	to := from.AddDate(0, 0, 1)
+
+	mustCreateWeight(t, repo, 1, 80, time.Date(2024, 3, 9, 14, 59, 59, 0, time.UTC))
+	inside := mustCreateWeight(t, repo, 1, 81, time.Date(2024, 3, 9, 15, 0, 0, 0, time.UTC))
+	lastSecond := mustCreateWeight(t, repo, 1, 82, time.Date(2024, 3, 10, 23, 59, 59, 0, tokyo))
+	mustCreateWeight(t, repo, 1, 83, time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC))
+
+	weights, err := repo.GetRange(1, from, to)
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+
+	want := []int{inside.ID, lastSecond.ID}
+	if got := weightIDs(weights); !equalIDs(got, want) {
+		t.Errorf("GetRange = %v, want %v", got, want)
+	}
+}
+
+func TestGetByDate(t *testing.T) {
+	repo := NewWeightRepository(newTestDB(t))
+
+	day := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	mustCreateWeight(t, repo, 1, 80, day.Add(-time.Second))
+	mustCreateWeight(t, repo, 1, 82, day.Add(20*time.Hour))
+	earliest := mustCreateWeight(t, repo, 1, 81, day)
+	mustCreateWeight(t, repo, 1, 83, day.AddDate(0, 0, 1))
+
+	weight, err := repo.GetByDate(1, day.Add(12*time.Hour))
+	if err != nil {
+		t.Fatalf("GetByDate: %v", err)
+	}
+	if weight.ID != earliest.ID {
+		t.Errorf("GetByDate returned entry %d, want %d", weight.ID, earliest.ID)
+	}
+
+	if _, err := repo.GetByDate(1, day.AddDate(0, 0, 5)); err != sql.ErrNoRows {
+		t.Errorf("GetByDate on an empty day: err = %v, want sql.ErrNoRows", err)
+	}
+}
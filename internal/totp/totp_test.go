@@ -0,0 +1,102 @@
+package totp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"hash"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238, Appendix B: 8 digit codes for a 30 second
+// period, with a seed of the ASCII string "1234567890" repeated to the
+// hash's block size.
+func TestRFC6238Vectors(t *testing.T) {
+	seeds := []struct {
+		name    string
+		newHash func() hash.Hash
+		key     []byte
+	}{
+		{"SHA1", sha1.New, []byte("12345678901234567890")},
+		{"SHA256", sha256.New, []byte("12345678901234567890123456789012")},
+		{"SHA512", sha512.New, []byte("1234567890123456789012345678901234567890123456789012345678901234")},
+	}
+
+	vectors := []struct {
+		unix  int64
+		codes [3]string // SHA1, SHA256, SHA512
+	}{
+		{59, [3]string{"94287082", "46119246", "90693936"}},
+		{1111111109, [3]string{"07081804", "68084774", "25091201"}},
+		{1111111111, [3]string{"14050471", "67062674", "99943326"}},
+		{1234567890, [3]string{"89005924", "91819424", "93441116"}},
+		{2000000000, [3]string{"69279037", "90698825", "38618901"}},
+		{20000000000, [3]string{"65353130", "77737706", "47863826"}},
+	}
+
+	for _, v := range vectors {
+		step := Step(time.Unix(v.unix, 0))
+		for i, seed := range seeds {
+			if got := code(seed.key, uint64(step), 8, seed.newHash); got != v.codes[i] {
+				t.Errorf("%s at %d = %s, want %s", seed.name, v.unix, got, v.codes[i])
+			}
+		}
+	}
+}
+
+func TestGenerateAndValidate(t *testing.T) {
+	// The SHA1 seed from RFC 6238 in base32, as an app would be given it
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	at := time.Unix(1111111109, 0)
+
+	got, err := Generate(secret, at)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if got != "081804" {
+		t.Errorf("code = %s, want 081804 (the last six digits of the RFC vector)", got)
+	}
+
+	// Codes from the neighbouring periods are accepted, older ones aren't
+	for offset, want := range map[time.Duration]bool{
+		-Period: true, 0: true, Period: true, -2 * Period: false, 2 * Period: false,
+	} {
+		step, ok := Validate(secret, got, at.Add(offset))
+		if ok != want {
+			t.Errorf("validate at %s offset = %v, want %v", offset, ok, want)
+		}
+		if ok && step != Step(at) {
+			t.Errorf("validate at %s offset returned step %d, want %d", offset, step, Step(at))
+		}
+	}
+
+	// Apps may show the secret in lower case with spaces
+	if _, ok := Validate(strings.ToLower(secret[:8])+" "+strings.ToLower(secret[8:]), got, at); !ok {
+		t.Error("secret with spaces and lower case was not accepted")
+	}
+
+	for _, bad := range []string{"", "08180", "0818044", "abcdef"} {
+		if _, ok := Validate(secret, bad, at); ok {
+			t.Errorf("code %q was accepted", bad)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("generate secret: %v", err)
+	}
+	key, err := decodeSecret(secret)
+	if err != nil || len(key) != secretBytes {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want %d", secret, len(key), err, secretBytes)
+	}
+
+	uri := URI("Weight Tracker", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Weight%20Tracker:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected URI %s", uri)
+	}
+}
@@ -0,0 +1,13 @@
+-- Weight goals; setting a new goal closes the previous one so history is kept
+CREATE TABLE goals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    start_weight_kg REAL NOT NULL CHECK (start_weight_kg > 0),
+    target_weight_kg REAL NOT NULL CHECK (target_weight_kg > 0),
+    target_date DATETIME,
+    created_at DATETIME NOT NULL,
+    closed_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_goals_user_id ON goals(user_id, created_at DESC);
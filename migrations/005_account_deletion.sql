@@ -0,0 +1,2 @@
+-- Accounts scheduled for deletion are disabled until delete_after, then purged
+ALTER TABLE users ADD COLUMN delete_after DATETIME;
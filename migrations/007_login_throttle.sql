@@ -0,0 +1,23 @@
+-- Failed login attempts per client IP and per username, so brute-force
+-- protection survives restarts
+CREATE TABLE login_throttles (
+    kind TEXT NOT NULL CHECK (kind IN ('ip', 'username')),
+    value TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at DATETIME NOT NULL,
+    locked_until DATETIME,
+    PRIMARY KEY (kind, value)
+);
+
+-- Audit trail of every lockout
+CREATE TABLE login_lockouts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    failures INTEGER NOT NULL,
+    ip_address TEXT NOT NULL,
+    locked_at DATETIME NOT NULL,
+    locked_until DATETIME NOT NULL
+);
+
+CREATE INDEX idx_login_lockouts_locked_at ON login_lockouts(locked_at);
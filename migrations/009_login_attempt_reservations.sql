@@ -0,0 +1,4 @@
+-- Login attempts are counted before the password is checked. The failure
+-- time they replaced is kept so an attempt that succeeds can be given back
+-- without restarting the backoff.
+ALTER TABLE login_throttles ADD COLUMN previous_failure_at DATETIME;
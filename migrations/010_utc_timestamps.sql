@@ -0,0 +1,56 @@
+-- Normalise timestamps written before the database stored times in UTC.
+-- Those were saved in Go's time.String() form with the server's local offset,
+-- e.g. "2024-01-02 08:30:00.5 +0100 CET m=+0.01", or by CURRENT_TIMESTAMP
+-- without an offset. Rewrite them as UTC in the driver's format so range
+-- queries compare them correctly. Only the original tables can hold them.
+CREATE TEMP TABLE legacy_times AS
+SELECT value AS legacy,
+       datetime(substr(value, 1, 19) || substr(utc_offset, 1, 3) || ':' || substr(utc_offset, 4, 2)) || fraction || '+00:00' AS utc
+FROM (
+    SELECT value, fraction, substr(value, 21 + length(fraction), 5) AS utc_offset
+    FROM (
+        SELECT value,
+               CASE WHEN substr(value, 20, 1) = '.' THEN substr(value, 20, instr(substr(value, 20), ' ') - 1) ELSE '' END AS fraction
+        FROM (
+            SELECT recorded_at AS value FROM weights
+            UNION SELECT created_at FROM weights
+            UNION SELECT updated_at FROM weights
+            UNION SELECT created_at FROM users
+            UNION SELECT updated_at FROM users
+            UNION SELECT created_at FROM settings
+            UNION SELECT updated_at FROM settings
+        )
+        WHERE typeof(value) = 'text'
+          AND value GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9] [0-9][0-9]:[0-9][0-9]:[0-9][0-9]* [+-][0-9][0-9][0-9][0-9] *'
+    )
+)
+UNION ALL
+SELECT value, value || '+00:00'
+FROM (
+    SELECT recorded_at AS value FROM weights
+    UNION SELECT created_at FROM weights
+    UNION SELECT updated_at FROM weights
+    UNION SELECT created_at FROM users
+    UNION SELECT updated_at FROM users
+    UNION SELECT created_at FROM settings
+    UNION SELECT updated_at FROM settings
+)
+WHERE typeof(value) = 'text'
+  AND value GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9] [0-9][0-9]:[0-9][0-9]:[0-9][0-9]';
+
+UPDATE weights SET recorded_at = (SELECT utc FROM legacy_times WHERE legacy = recorded_at)
+WHERE recorded_at IN (SELECT legacy FROM legacy_times);
+UPDATE weights SET created_at = (SELECT utc FROM legacy_times WHERE legacy = created_at)
+WHERE created_at IN (SELECT legacy FROM legacy_times);
+UPDATE weights SET updated_at = (SELECT utc FROM legacy_times WHERE legacy = updated_at)
+WHERE updated_at IN (SELECT legacy FROM legacy_times);
+UPDATE users SET created_at = (SELECT utc FROM legacy_times WHERE legacy = created_at)
+WHERE created_at IN (SELECT legacy FROM legacy_times);
+UPDATE users SET updated_at = (SELECT utc FROM legacy_times WHERE legacy = updated_at)
+WHERE updated_at IN (SELECT legacy FROM legacy_times);
+UPDATE settings SET created_at = (SELECT utc FROM legacy_times WHERE legacy = created_at)
+WHERE created_at IN (SELECT legacy FROM legacy_times);
+UPDATE settings SET updated_at = (SELECT utc FROM legacy_times WHERE legacy = updated_at)
+WHERE updated_at IN (SELECT legacy FROM legacy_times);
+
+DROP TABLE legacy_times;
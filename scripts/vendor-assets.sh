@@ -0,0 +1,30 @@
+#!/bin/sh
+# Downloads HTMX and Chart.js and builds the Tailwind stylesheet into static/,
+# where they are embedded into the binary. Run through `make assets` whenever
+# a version changes or templates use new Tailwind classes.
+set -eu
+
+HTMX_VERSION=1.9.10
+CHARTJS_VERSION=4.4.1
+TAILWIND_VERSION=3.4.1
+
+cd "$(dirname "$0")/.."
+mkdir -p static/js static/css bin
+
+curl -fsSL -o static/js/htmx.min.js "https://unpkg.com/htmx.org@${HTMX_VERSION}/dist/htmx.min.js"
+curl -fsSL -o static/js/chart.umd.js "https://cdn.jsdelivr.net/npm/chart.js@${CHARTJS_VERSION}/dist/chart.umd.js"
+
+case "$(uname -s)-$(uname -m)" in
+	Linux-x86_64) platform=linux-x64 ;;
+	Linux-aarch64) platform=linux-arm64 ;;
+	Darwin-x86_64) platform=macos-x64 ;;
+	Darwin-arm64) platform=macos-arm64 ;;
+	*) echo "No Tailwind CLI for $(uname -s) $(uname -m)" >&2; exit 1 ;;
+esac
+
+tailwind="bin/tailwindcss-${TAILWIND_VERSION}"
+if [ ! -x "$tailwind" ]; then
+	curl -fsSL -o "$tailwind" "https://github.com/tailwindlabs/tailwindcss/releases/download/v${TAILWIND_VERSION}/tailwindcss-${platform}"
+	chmod +x "$tailwind"
+fi
+"$tailwind" --config scripts/tailwind.config.js --input scripts/tailwind.css --output static/css/app.css --minify
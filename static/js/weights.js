@@ -0,0 +1,164 @@
+// Chart and statistics on the weight history page
+
+let weightChart;
+
+const poundsPerStone = 14;
+
+// Format a weight in the user's unit; stones are shown as "st lb"
+function formatWeight(value, unit) {
+    if (unit === 'st') {
+        const pounds = Math.round(value * poundsPerStone * 10) / 10;
+        const stones = Math.floor(pounds / poundsPerStone);
+        return stones + ' st ' + (pounds - stones * poundsPerStone).toFixed(1) + ' lb';
+    }
+    return value.toFixed(1) + ' ' + unit;
+}
+
+// Changes in stones read better as pounds
+function formatChange(value, unit) {
+    if (unit === 'st') {
+        value = value * poundsPerStone;
+        unit = 'lb';
+    }
+    return (value >= 0 ? '+' : '') + value.toFixed(1) + ' ' + unit;
+}
+
+function loadChart() {
+    const overlays = Array.from(document.querySelectorAll('.chart-overlay:checked')).map(box => box.value);
+
+    const params = new URLSearchParams({
+        range: document.getElementById('chart-range').value,
+        bucket: document.getElementById('chart-bucket').value,
+        overlays: overlays.join(',')
+    });
+
+    fetch('/api/chart/weight-data?' + params)
+        .then(response => response.json())
+        .then(data => {
+            const ctx = document.getElementById('weightChart').getContext('2d');
+
+            if (weightChart) {
+                weightChart.destroy();
+            }
+
+            weightChart = new Chart(ctx, {
+                type: 'line',
+                data: data,
+                options: {
+                    responsive: true,
+                    maintainAspectRatio: false,
+                    plugins: {
+                        legend: {
+                            display: data.datasets.length > 1
+                        },
+                        tooltip: {
+                            mode: 'index',
+                            intersect: false,
+                            callbacks: {
+                                label: function(context) {
+                                    if (context.parsed.y === null) {
+                                        return null;
+                                    }
+                                    return context.dataset.label + ': ' + formatWeight(context.parsed.y, data.unit);
+                                },
+                                afterLabel: function(context) {
+                                    // Spread of the readings behind a bucketed point
+                                    const bucket = data.buckets[context.dataIndex];
+                                    if (context.datasetIndex !== 0 || !bucket || bucket.count < 2) {
+                                        return null;
+                                    }
+                                    return formatWeight(bucket.min, data.unit) + ' – ' + formatWeight(bucket.max, data.unit) +
+                                        ' (' + bucket.count + ' readings)';
+                                }
+                            }
+                        }
+                    },
+                    scales: {
+                        x: {
+                            display: true,
+                            title: {
+                                display: true,
+                                text: 'Date'
+                            }
+                        },
+                        y: {
+                            display: true,
+                            title: {
+                                display: true,
+                                text: 'Weight (' + data.unit + ')'
+                            }
+                        }
+                    },
+                    interaction: {
+                        mode: 'nearest',
+                        axis: 'x',
+                        intersect: false
+                    }
+                }
+            });
+        })
+        .catch(error => {
+            console.error('Error loading chart:', error);
+        });
+}
+
+function loadStats() {
+    fetch('/api/chart/weight-stats')
+        .then(response => response.json())
+        .then(stats => {
+            document.getElementById('current-weight').textContent =
+                stats.current_weight ? formatWeight(stats.current_weight, stats.unit) : '-';
+
+            const change7Days = document.getElementById('change-7-days');
+            if (stats.change_7_days) {
+                const change = stats.change_7_days;
+                change7Days.textContent = formatChange(change, stats.unit);
+                change7Days.className = `text-2xl font-bold ${change >= 0 ? 'text-red-600' : 'text-green-600'}`;
+            } else {
+                change7Days.textContent = '-';
+            }
+
+            const change30Days = document.getElementById('change-30-days');
+            if (stats.change_30_days) {
+                const change = stats.change_30_days;
+                change30Days.textContent = formatChange(change, stats.unit);
+                change30Days.className = `text-2xl font-bold ${change >= 0 ? 'text-red-600' : 'text-green-600'}`;
+            } else {
+                change30Days.textContent = '-';
+            }
+
+            document.getElementById('average-weight').textContent =
+                stats.average_weight ? formatWeight(stats.average_weight, stats.unit) : '-';
+
+            document.getElementById('rolling-average-7-days').textContent =
+                stats.rolling_average_7_days !== null ? formatWeight(stats.rolling_average_7_days, stats.unit) : '-';
+
+            document.getElementById('weekly-rate').textContent =
+                stats.total_entries > 1 ? formatChange(stats.weekly_rate, stats.unit) + '/week' : '-';
+
+            document.getElementById('current-streak').textContent =
+                stats.total_entries ? stats.current_streak + (stats.current_streak === 1 ? ' day' : ' days') : '-';
+            document.getElementById('longest-streak').textContent =
+                stats.total_entries ? 'Longest: ' + stats.longest_streak + (stats.longest_streak === 1 ? ' day' : ' days') : '';
+
+            document.getElementById('volatility').textContent =
+                stats.total_entries > 1 ? '±' + formatChange(stats.volatility, stats.unit).substring(1) : '-';
+        })
+        .catch(error => {
+            console.error('Error loading stats:', error);
+        });
+}
+
+// Load chart and stats when page loads
+document.addEventListener('DOMContentLoaded', function() {
+    loadChart();
+    loadStats();
+});
+
+document.querySelectorAll('.chart-overlay, .chart-control').forEach(input => input.addEventListener('change', loadChart));
+
+// Refresh chart whenever an entry is added, edited or deleted
+document.body.addEventListener('weights-changed', function() {
+    loadChart();
+    loadStats();
+});
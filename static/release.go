@@ -0,0 +1,12 @@
+//go:build release
+
+package static
+
+import "embed"
+
+// Release builds name the vendored assets explicitly, so compiling fails
+// instead of shipping pages without HTMX, Chart.js or styles when `make
+// assets` hasn't been run.
+//
+//go:embed js/htmx.min.js js/chart.umd.js css/app.css
+var vendored embed.FS
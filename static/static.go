@@ -0,0 +1,112 @@
+// Package static embeds the CSS and JavaScript served under /static/ so the
+// binary runs without network access to a CDN. Each file is also served
+// under a name containing a hash of its contents, which browsers may cache
+// for good; templates link to that name through Path.
+//
+// Third-party files are vendored with `make assets`. Build with the release
+// tag to make their absence a compile error.
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed css js
+var files embed.FS
+
+// Vendored lists the third-party assets that `make assets` downloads or builds.
+// Keep it in sync with the embed list in release.go.
+var Vendored = []string{"js/htmx.min.js", "js/chart.umd.js", "css/app.css"}
+
+type asset struct {
+	name string // Path within the embedded files, e.g. "js/htmx.min.js"
+	hash string
+}
+
+var (
+	byName   = map[string]asset{}
+	byHashed = map[string]asset{}
+)
+
+func init() {
+	fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		a := asset{name: name, hash: hex.EncodeToString(sum[:4])}
+		byName[name] = a
+		byHashed[hashedName(a)] = a
+		return nil
+	})
+}
+
+// hashedName puts the hash before the extension: js/htmx.min.1a2b3c4d.js.
+func hashedName(a asset) string {
+	ext := path.Ext(a.name)
+	return strings.TrimSuffix(a.name, ext) + "." + a.hash + ext
+}
+
+// Path returns the URL to link to an asset by, e.g. "/static/js/htmx.min.1a2b3c4d.js"
+// for "js/htmx.min.js". Unknown files get their plain path.
+func Path(name string) string {
+	if a, ok := byName[name]; ok {
+		return "/static/" + hashedName(a)
+	}
+	return "/static/" + name
+}
+
+// Missing returns the vendored assets that aren't in this build.
+func Missing() []string {
+	var missing []string
+	for _, name := range Vendored {
+		if _, ok := byName[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// Handler serves the embedded files; mount it with the /static/ prefix
+// stripped. Hashed names never change content, so they are cached for a
+// year; plain names must be revalidated.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		a, hashed := byHashed[name]
+		if !hashed {
+			var ok bool
+			if a, ok = byName[name]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+		}
+
+		data, err := files.ReadFile(a.name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if hashed {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		w.Header().Set("ETag", `"`+a.hash+`"`)
+		http.ServeContent(w, r, a.name, time.Time{}, bytes.NewReader(data))
+	})
+}
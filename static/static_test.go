@@ -0,0 +1,40 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	hashed := Path("css/style.css")
+	if hashed == "/static/css/style.css" || !strings.HasPrefix(hashed, "/static/css/style.") {
+		t.Fatalf("Path = %q, want a hashed name", hashed)
+	}
+
+	tests := []struct {
+		path      string
+		wantCode  int
+		wantCache string
+	}{
+		{strings.TrimPrefix(hashed, "/static"), http.StatusOK, "public, max-age=31536000, immutable"},
+		{"/css/style.css", http.StatusOK, "no-cache"},
+		{"/css/missing.css", http.StatusNotFound, ""},
+		{"/static.go", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s: status = %d, want %d", tt.path, rec.Code, tt.wantCode)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != tt.wantCache {
+			t.Errorf("%s: Cache-Control = %q, want %q", tt.path, got, tt.wantCache)
+		}
+		if tt.wantCode == http.StatusOK && !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/css") {
+			t.Errorf("%s: Content-Type = %q", tt.path, rec.Header().Get("Content-Type"))
+		}
+	}
+}